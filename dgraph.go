@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"strings"
+	"net"
+	"sync"
 	"time"
 
 	dgo "github.com/dgraph-io/dgo/v200"
@@ -13,6 +15,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -24,16 +27,47 @@ const (
 )
 
 type GraphConnection struct {
+	mu         sync.RWMutex // guards gCl, gConns and gen, which change on reconnect
+	reopenMu   sync.Mutex   // serializes reconnects from concurrent callers
 	gCl        *dgo.Dgraph
+	gen        uint64 // generation of the connections, incremented when they are opened
 	gConnsURLS []string
 	gConns     []*grpc.ClientConn
 	logger     *zap.Logger
+	opts       ConnOptions
+	onRetry    func(op string, category ErrorCategory, attempt int, err error)
+	recorder   *requestRecorder
+}
+
+// ConnOptions holds the options of a GraphConnection.
+type ConnOptions struct {
+	Retry          RetryPolicy
+	ReconnectDelay time.Duration   // wait between closing and reopening a broken connection
+	Encoding       string          // encoding of the mutations (nquads, json)
+	TLS            *tls.Config     // dial without TLS if nil
+	ACL            *ACLCredentials // log in after dialing if not nil
+	// Dialer overrides how the connections to the URLs are dialed, e.g. to
+	// connect to an in-process server.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// ACLCredentials are the credentials used to log in to a dgraph cluster with
+// ACLs enabled.
+type ACLCredentials struct {
+	User      string
+	Password  string
+	Namespace uint64 // only the default namespace 0 is supported by the dgo v200 client
+}
+
+// DefaultConnOptions returns the options used when none are configured.
+func DefaultConnOptions() ConnOptions {
+	return ConnOptions{Retry: DefaultRetryPolicy, ReconnectDelay: 5 * time.Second, Encoding: encodingNQuads}
 }
 
 type Schema string
 
 // NewGraphConnection sets up and opens a new Dgraph connection.
-func NewGraphConnection(ctx context.Context, dgraphURLs []string, logger *zap.Logger) (*GraphConnection, error) {
+func NewGraphConnection(ctx context.Context, dgraphURLs []string, opts ConnOptions, logger *zap.Logger) (*GraphConnection, error) {
 	// Init logger
 	if logger == nil {
 		logger, _ = zap.NewDevelopment()
@@ -47,6 +81,7 @@ func NewGraphConnection(ctx context.Context, dgraphURLs []string, logger *zap.Lo
 	gc := &GraphConnection{
 		gConnsURLS: dgraphURLs,
 		logger:     logger,
+		opts:       opts,
 	}
 
 	return gc, gc.openConnection(ctx)
@@ -54,6 +89,8 @@ func NewGraphConnection(ctx context.Context, dgraphURLs []string, logger *zap.Lo
 
 // Ready returns true if all connections are in a Ready state.
 func (gc *GraphConnection) Ready() (ready bool) {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
 	for _, conn := range gc.gConns {
 		if conn.GetState() == connectivity.Ready {
 			ready = true
@@ -70,8 +107,13 @@ func (gc *GraphConnection) openConnection(ctx context.Context) error {
 	backoffConfig := backoff.DefaultConfig
 	backoffConfig.MaxDelay = 30 * time.Second
 
+	transportOpt := grpc.WithInsecure()
+	if gc.opts.TLS != nil {
+		transportOpt = grpc.WithTransportCredentials(credentials.NewTLS(gc.opts.TLS))
+	}
+
 	dgraphOpts := []grpc.DialOption{
-		grpc.WithInsecure(),
+		transportOpt,
 		grpc.WithBlock(),
 		grpc.FailOnNonTempDialError(true),
 		grpc.WithConnectParams(
@@ -85,6 +127,9 @@ func (gc *GraphConnection) openConnection(ctx context.Context) error {
 			grpc.MaxCallSendMsgSize(maxSendMsgSize),
 		),
 	}
+	if gc.opts.Dialer != nil {
+		dgraphOpts = append(dgraphOpts, grpc.WithContextDialer(gc.opts.Dialer))
+	}
 
 	var dgGrpcConns []*grpc.ClientConn
 	var dgAPICls []dgoapi.DgraphClient
@@ -104,88 +149,201 @@ func (gc *GraphConnection) openConnection(ctx context.Context) error {
 		return fmt.Errorf("unable to connect to dgraph alpha servers at URLs: %v", gc.gConnsURLS)
 	}
 
+	gCl := dgo.NewDgraphClient(dgAPICls...)
+	if gc.opts.ACL != nil {
+		if err := gc.login(ctx, gCl); err != nil {
+			for _, conn := range dgGrpcConns {
+				conn.Close()
+			}
+			return err
+		}
+	}
+
+	gc.mu.Lock()
 	gc.gConns = dgGrpcConns
-	gc.gCl = dgo.NewDgraphClient(dgAPICls...)
+	gc.gCl = gCl
+	gc.gen++
+	gc.mu.Unlock()
+	return nil
+}
+
+// login logs the client in with the ACL credentials.
+func (gc *GraphConnection) login(ctx context.Context, gCl *dgo.Dgraph) error {
+	acl := gc.opts.ACL
+	if acl.Namespace != 0 {
+		return fmt.Errorf("unable to log in to dgraph namespace %d: only the default namespace is supported by the dgo v200 client", acl.Namespace)
+	}
+	err := gCl.Login(ctx, acl.User, acl.Password)
+	loginsTotal.WithLabelValues(statusLabel(err)).Inc()
+	if err != nil {
+		return fmt.Errorf("unable to log in to dgraph as %s: %s", acl.User, err)
+	}
 	return nil
 }
 
+// OnRetry sets a function called every time a failed operation is retried.
+// It must be set before the connection is used.
+func (gc *GraphConnection) OnRetry(fn func(op string, category ErrorCategory, attempt int, err error)) {
+	gc.onRetry = fn
+}
+
+// RecordTo sets a recorder of the mutation requests sent. It must be set
+// before the connection is used.
+func (gc *GraphConnection) RecordTo(rr *requestRecorder) {
+	gc.recorder = rr
+}
+
+// client returns the current dgraph client.
+func (gc *GraphConnection) client() *dgo.Dgraph {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
+	return gc.gCl
+}
+
+// clientGen returns the current dgraph client and the generation of its
+// connections.
+func (gc *GraphConnection) clientGen() (*dgo.Dgraph, uint64) {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
+	return gc.gCl, gc.gen
+}
+
 func (gc *GraphConnection) LoadSchema(ctx context.Context, schema Schema) (err error) {
+	startTime := time.Now()
+	defer func() {
+		schemaAlterDuration.Observe(time.Since(startTime).Seconds())
+		schemaAltersTotal.WithLabelValues(statusLabel(err)).Inc()
+	}()
 	op := &dgoapi.Operation{Schema: string(schema)}
-	timeout := dgTimeout
-	retry := 0
-	for {
-		err = gc.gCl.Alter(ctx, op)
+	return gc.withRetry(ctx, "alter", "alter schema", func(cl *dgo.Dgraph) error {
+		return cl.Alter(ctx, op)
+	})
+}
+
+func (gc *GraphConnection) Mutate(ctx context.Context, q *Quads) (err error) {
+	startTime := time.Now()
+	defer func() {
+		mutationDuration.Observe(time.Since(startTime).Seconds())
+		mutationsTotal.WithLabelValues(statusLabel(err)).Inc()
 		if err == nil {
-			if retry > 0 {
-				gc.logger.Warn("dgraph alter schema retry successful", zap.Int("attempt", retry))
-			}
-			break
-		} else {
-			retryAgain, nextRetry, reopenErr := gc.checkError(ctx, err, retry, dgMaxRetries)
-			if reopenErr != nil {
-				return fmt.Errorf("unable to reconnect to dgraph: %s", err)
-			}
-			if !retryAgain {
-				return fmt.Errorf("unable to perform dgraph alter schema in %d attempts: %s", retry, err)
-			}
-			retry = nextRetry
-			gc.logger.Warn("dgraph alter schema failed, retrying...", zap.Error(err), zap.Duration("retry-in", timeout), zap.Int("attempt", retry))
+			quadsSentTotal.Add(float64(q.Size()))
 		}
-		time.Sleep(timeout)
-		timeout *= 2
+	}()
+	if err := q.Err(); err != nil {
+		return fmt.Errorf("invalid mutation: %s", err)
 	}
-	return nil
+	req := q.Request()
+	if gc.opts.Encoding == encodingJSON {
+		if req, err = q.JSONRequest(); err != nil {
+			return err
+		}
+	}
+	return gc.send(ctx, req)
 }
 
-func (gc *GraphConnection) Mutate(ctx context.Context, q *Quads) (err error) {
-	req := q.Request()
-	timeout := dgTimeout
-	retry := 0
+// Replay sends a mutation request as recorded, e.g. by a requestRecorder.
+func (gc *GraphConnection) Replay(ctx context.Context, req *dgoapi.Request) (err error) {
+	startTime := time.Now()
+	defer func() {
+		mutationDuration.Observe(time.Since(startTime).Seconds())
+		mutationsTotal.WithLabelValues(statusLabel(err)).Inc()
+	}()
+	return gc.send(ctx, req)
+}
+
+// send records a mutation request, if recording, and performs it in a
+// transaction.
+func (gc *GraphConnection) send(ctx context.Context, req *dgoapi.Request) error {
+	if gc.recorder != nil {
+		gc.recorder.Record(req)
+	}
+	return gc.withRetry(ctx, "mutate", "transaction", func(cl *dgo.Dgraph) error {
+		_, err := cl.NewTxn().Do(ctx, req)
+		return err
+	})
+}
+
+// Query performs a read-only query with the given variables.
+func (gc *GraphConnection) Query(ctx context.Context, query string, vars map[string]string) (resp *dgoapi.Response, err error) {
+	startTime := time.Now()
+	defer func() {
+		queryDuration.Observe(time.Since(startTime).Seconds())
+		queriesTotal.WithLabelValues(statusLabel(err)).Inc()
+	}()
+	err = gc.withRetry(ctx, "query", "query", func(cl *dgo.Dgraph) error {
+		var err error
+		resp, err = cl.NewReadOnlyTxn().QueryWithVars(ctx, query, vars)
+		return err
+	})
+	return resp, err
+}
+
+// withRetry calls fn with the current dgraph client until it succeeds, fails
+// with an error that should not be retried, or the retry policy is exhausted,
+// in which case the last error is returned as an *OpError. The op is used to
+// label the metrics and desc to describe the operation in logs and errors.
+func (gc *GraphConnection) withRetry(ctx context.Context, op, desc string, fn func(cl *dgo.Dgraph) error) (err error) {
+	policy := gc.opts.Retry
+	startTime := time.Now()
+	attempt := 0
 	for {
-		_, err = gc.gCl.NewTxn().Do(ctx, req)
+		attempt++
+		cl, gen := gc.clientGen()
+		err = fn(cl)
 		if err == nil {
-			if retry > 0 {
-				gc.logger.Warn("dgraph transaction retry successful", zap.Int("attempt", retry))
-			}
-			break
-		} else {
-			retryAgain, nextRetry, reopenErr := gc.checkError(ctx, err, retry, dgMaxRetries)
-			if reopenErr != nil {
-				return fmt.Errorf("unable to reconnect to dgraph: %s", err)
-			}
-			if !retryAgain {
-				return fmt.Errorf("unable to perform dgraph transaction in %d attempts: %s", retry, err)
+			if attempt > 1 {
+				gc.logger.Warn("dgraph "+desc+" retry successful", zap.Int("attempt", attempt-1))
 			}
-			retry = nextRetry
-			gc.logger.Warn("dgraph transaction failed, retrying...", zap.Error(err), zap.Duration("retry-in", timeout), zap.Int("attempt", retry))
+			return nil
+		}
+
+		delay := policy.Delay(attempt)
+		category, retryAgain, recoverErr := gc.checkError(ctx, err, gen, attempt, time.Since(startTime), delay)
+		if recoverErr != nil {
+			errorsTotal.WithLabelValues(op, string(category)).Inc()
+			return &OpError{Op: desc, Category: category, Attempts: attempt, Err: recoverErr}
+		}
+		if !retryAgain {
+			errorsTotal.WithLabelValues(op, string(category)).Inc()
+			return &OpError{Op: desc, Category: category, Attempts: attempt, Err: err}
+		}
+		if category == ErrTokenExpired {
+			delay = 0 // the client logged in again, no need to wait
+		}
+		retriesTotal.WithLabelValues(op, string(category)).Inc()
+		if gc.onRetry != nil {
+			gc.onRetry(op, category, attempt, err)
+		}
+		gc.logger.Warn("dgraph "+desc+" failed, retrying...", zap.Error(err), zap.String("category", string(category)), zap.Duration("retry-in", delay), zap.Int("attempt", attempt))
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			errorsTotal.WithLabelValues(op, string(category)).Inc()
+			return &OpError{Op: desc, Category: category, Attempts: attempt, Err: fmt.Errorf("%s (retry cancelled: %s)", err, sleepErr)}
 		}
-		time.Sleep(timeout)
-		timeout *= 2
 	}
-	return nil
 }
 
-// checkError looks for errors that should be retried.
-func (gc *GraphConnection) checkError(ctx context.Context, err error, retry, maxRetries int) (retryAgain bool, nextRetry int, reopenErr error) {
-	if retry >= maxRetries {
+// checkError classifies an error and decides whether it should be retried
+// after the given attempts, elapsed time and delay before the retry. The
+// connections of generation gen, which returned the error, are reopened
+// first for connection errors, and the client logs in again first for
+// expired ACL tokens; recoverErr is set if that failed.
+func (gc *GraphConnection) checkError(ctx context.Context, err error, gen uint64, attempts int, elapsed, delay time.Duration) (category ErrorCategory, retryAgain bool, recoverErr error) {
+	category = classifyError(err)
+	if category == ErrTokenExpired && gc.opts.ACL == nil {
+		category = ErrPermanent // no credentials to log in again with
+	}
+	if !category.Retryable() || !gc.opts.Retry.Allows(attempts, elapsed, delay) || ctx.Err() != nil {
 		return // do not retry (retryAgain == false)
 	}
-	nextRetry = retry + 1
-	errStr := strings.ToLower(err.Error())
-	// check to see if the error is one that should be retried, or if the
-	// connection should be reopened first and then retried, or if it an
-	// error that should not be retried.
-	if err == dgo.ErrAborted || strings.Contains(errStr, "aborted") || strings.Contains(errStr, "less than mints") || strings.Contains(errStr, "transaction is too old") {
-		retryAgain = true
-	} else if strings.Contains(errStr, "transport is closing") || strings.Contains(errStr, "unhealthy connection") {
-		retryAgain = true
-		gc.closeConnection()
-		time.Sleep(5 * time.Second)
-		reopenErr = gc.openConnection(ctx)
-	} else {
-		retryAgain = false
+	switch category {
+	case ErrUnavailable:
+		if reopenErr := gc.reopenConnection(ctx, gen); reopenErr != nil {
+			recoverErr = fmt.Errorf("unable to reconnect to dgraph: %s", reopenErr)
+		}
+	case ErrTokenExpired:
+		recoverErr = gc.login(ctx, gc.client())
 	}
-	return // do not retry (retryAgain == false)
+	return category, true, recoverErr
 }
 
 // Close closes the dgraph connections.
@@ -193,7 +351,26 @@ func (gc *GraphConnection) Close() {
 	gc.closeConnection()
 }
 
+// reopenConnection closes and reopens the dgraph connections of generation
+// gen. It does nothing if they were already reopened by a concurrent caller.
+func (gc *GraphConnection) reopenConnection(ctx context.Context, gen uint64) error {
+	gc.reopenMu.Lock()
+	defer gc.reopenMu.Unlock()
+	if _, current := gc.clientGen(); current != gen {
+		return nil
+	}
+	gc.closeConnection()
+	err := sleepContext(ctx, gc.opts.ReconnectDelay)
+	if err == nil {
+		err = gc.openConnection(ctx)
+	}
+	reconnectsTotal.WithLabelValues(statusLabel(err)).Inc()
+	return err
+}
+
 func (gc *GraphConnection) closeConnection() {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
 	if gc.gCl != nil {
 		for _, conn := range gc.gConns {
 			conn.Close()
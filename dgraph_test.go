@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGraphConnectionLoadSchema(t *testing.T) {
+	fs := startFakeServer(t)
+	gc := fs.connect(t, fs.connOptions())
+
+	schema := buildSchema(2, 3)
+	if err := gc.LoadSchema(context.Background(), schema); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	alters := fs.Alters()
+	if len(alters) != 1 {
+		t.Fatalf("expected 1 alter, got %d", len(alters))
+	}
+	if alters[0].Schema != string(schema) {
+		t.Errorf("expected schema %q, got %q", schema, alters[0].Schema)
+	}
+}
+
+func TestGraphConnectionMutate(t *testing.T) {
+	fs := startFakeServer(t)
+	gc := fs.connect(t, fs.connOptions())
+
+	q := NewQuads()
+	q.SetQuadStr("_:a", "name", "a")
+	q.SetQuadRel("_:a", "LINK0", "_:b")
+	if err := gc.Mutate(context.Background(), q); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reqs := fs.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(reqs))
+	}
+	if !reqs[0].CommitNow || len(reqs[0].Mutations) != 1 || len(reqs[0].Mutations[0].Set) != 2 {
+		t.Errorf("unexpected request: %v", reqs[0])
+	}
+}
+
+func TestGraphConnectionQuery(t *testing.T) {
+	fs := startFakeServer(t)
+	fs.setQueryJSON(`{"q":[{"uid":"0x1"}]}`)
+	gc := fs.connect(t, fs.connOptions())
+
+	resp, err := gc.Query(context.Background(), "query q($n: string) { q(func: eq(name, $n)) { uid } }", map[string]string{"$n": "a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(resp.Json) != `{"q":[{"uid":"0x1"}]}` {
+		t.Errorf("unexpected response %s", resp.Json)
+	}
+	reqs := fs.Requests()
+	if len(reqs) != 1 || !reqs[0].ReadOnly || reqs[0].Vars["$n"] != "a" {
+		t.Errorf("unexpected requests: %v", reqs)
+	}
+}
+
+func TestGraphConnectionRetriesAborted(t *testing.T) {
+	fs := startFakeServer(t)
+	fs.failNext("Query", status.Error(codes.Aborted, "Transaction has been aborted. Please retry"))
+	gc := fs.connect(t, fs.connOptions())
+	var retries []ErrorCategory
+	gc.OnRetry(func(op string, category ErrorCategory, attempt int, err error) {
+		retries = append(retries, category)
+	})
+
+	q := NewQuads()
+	q.SetQuadStr("_:a", "name", "a")
+	if err := gc.Mutate(context.Background(), q); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := len(fs.Requests()); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+	if len(retries) != 1 || retries[0] != ErrAborted {
+		t.Errorf("expected 1 aborted retry, got %v", retries)
+	}
+}
+
+func TestGraphConnectionGivesUp(t *testing.T) {
+	fs := startFakeServer(t)
+	aborted := status.Error(codes.Aborted, "Transaction has been aborted. Please retry")
+	fs.failNext("Query", aborted, aborted, aborted)
+	gc := fs.connect(t, fs.connOptions())
+
+	err := gc.Mutate(context.Background(), NewQuads())
+	var opErr *OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("expected an OpError, got %v", err)
+	}
+	if opErr.Category != ErrAborted || opErr.Attempts != 3 {
+		t.Errorf("expected 3 aborted attempts, got %d %s", opErr.Attempts, opErr.Category)
+	}
+}
+
+func TestGraphConnectionDoesNotRetryInvalid(t *testing.T) {
+	fs := startFakeServer(t)
+	fs.failNext("Alter", status.Error(codes.InvalidArgument, "while lexing name: strin ."))
+	gc := fs.connect(t, fs.connOptions())
+
+	err := gc.LoadSchema(context.Background(), Schema("name: strin ."))
+	if ErrorCategoryOf(err) != ErrInvalidSchema {
+		t.Fatalf("expected an invalid schema error, got %v", err)
+	}
+	if n := len(fs.Alters()); n != 1 {
+		t.Errorf("expected 1 alter, got %d", n)
+	}
+}
+
+func TestClassifyUnknown(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want ErrorCategory
+	}{
+		{"while lexing name: strin . at line 1 column 6: Invalid ending", ErrInvalidSchema},
+		{"Schema change not allowed from scalar to uid or vice versa while there is data for pred: name", ErrInvalidSchema},
+		{"Input for predicate \"LINK0\" of type uid is scalar. Edge: entity:1", ErrInvalidSchema},
+		{"Predicate pred0 is not indexed", ErrInvalidSchema},
+		{"Transaction is too old", ErrAborted},
+		{"Unhealthy connection", ErrUnavailable},
+		{"Unable to fetch the schema from the cluster", ErrPermanent},
+		{"error while writing schema to disk: no space left on device", ErrPermanent},
+	}
+	for _, tt := range tests {
+		err := status.Error(codes.Unknown, tt.msg)
+		if got := classifyError(err); got != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.msg, tt.want, got)
+		}
+	}
+}
+
+func TestGraphConnectionReconnects(t *testing.T) {
+	fs := startFakeServer(t)
+	fs.failNext("Alter", status.Error(codes.Unavailable, "connection closed"))
+	gc := fs.connect(t, fs.connOptions())
+
+	if err := gc.LoadSchema(context.Background(), Schema("name: string .")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := fs.Dials(); n != 2 {
+		t.Errorf("expected 2 dials, got %d", n)
+	}
+	if n := len(fs.Alters()); n != 2 {
+		t.Errorf("expected 2 alters, got %d", n)
+	}
+}
+
+func TestGraphConnectionReconnectsOnce(t *testing.T) {
+	fs := startFakeServer(t)
+	gc := fs.connect(t, fs.connOptions())
+
+	// Concurrent callers failing on the same connections reopen them once;
+	// the later callers keep the connections reopened by the first.
+	_, gen := gc.clientGen()
+	for i := 0; i < 4; i++ {
+		if err := gc.reopenConnection(context.Background(), gen); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if n := fs.Dials(); n != 2 {
+		t.Errorf("expected 2 dials, got %d", n)
+	}
+	if err := gc.LoadSchema(context.Background(), Schema("name: string .")); err != nil {
+		t.Errorf("unexpected error on the reopened connection: %s", err)
+	}
+}
+
+func TestGraphConnectionLogsInAgain(t *testing.T) {
+	fs := startFakeServer(t)
+	opts := fs.connOptions()
+	opts.ACL = &ACLCredentials{User: "groot", Password: "password"}
+	gc := fs.connect(t, opts)
+
+	// The dgo client refreshes the token once by itself; the connection must
+	// log in again with the credentials when that is not enough.
+	expired := status.Error(codes.Unauthenticated, "Token is expired")
+	fs.failNext("Query", expired, expired)
+	if _, err := gc.Query(context.Background(), "{ q(func: has(name)) { uid } }", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	logins := fs.Logins()
+	if len(logins) != 3 {
+		t.Fatalf("expected 3 logins, got %d", len(logins))
+	}
+	if logins[0].Userid != "groot" || logins[2].Userid != "groot" || logins[2].Password != "password" {
+		t.Errorf("expected logins with the credentials, got %v", logins)
+	}
+}
+
+func TestGraphConnectionRejectsNamespace(t *testing.T) {
+	fs := startFakeServer(t)
+	opts := fs.connOptions()
+	opts.ACL = &ACLCredentials{User: "groot", Password: "password", Namespace: 1}
+
+	_, err := NewGraphConnection(context.Background(), []string{"bufconn"}, opts, nil)
+	if err == nil {
+		t.Fatal("expected an error logging in to a namespace")
+	}
+	if n := len(fs.Logins()); n != 0 {
+		t.Errorf("expected no logins, got %d", n)
+	}
+}
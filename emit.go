@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// emitSchemaFile is the name of the schema file written to the emit directory.
+const emitSchemaFile = "graph.schema"
+
+// emitWorkload writes the mutation built by a generator in every round to
+// files instead of sending it to dgraph. Each round is written to files named
+// after the worker and round: the upsert query to a .dql file and the quads to
+// set and delete to .rdf and .del.rdf files, or .json and .del.json files
+// with the JSON encoding, when there are any.
+type emitWorkload struct {
+	gen      Generator
+	dir      string
+	encoding string
+}
+
+// newEmitWorkload creates the directory dir, writes the schema to it, and
+// returns a workload writing the rounds of gen to it in the given encoding.
+func newEmitWorkload(gen Generator, schema Schema, dir, encoding string) (*emitWorkload, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create emit directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, emitSchemaFile), []byte(schema), 0644); err != nil {
+		return nil, fmt.Errorf("unable to write schema file: %s", err)
+	}
+	return &emitWorkload{gen: gen, dir: dir, encoding: encoding}, nil
+}
+
+func (wl *emitWorkload) Header() string {
+	return fmt.Sprintf("Dry run to %s: %s", wl.dir, wl.gen.Header())
+}
+
+func (wl *emitWorkload) Do(ctx context.Context, w *worker, round int) opResult {
+	buildRound(wl.gen, w, round)
+
+	startTime := time.Now()
+	err := wl.writeRound(w.id, round, w.quads)
+	return opResult{op: "emit", quads: w.quads, latency: time.Since(startTime), err: err}
+}
+
+func (wl *emitWorkload) writeRound(worker, round int, q *Quads) error {
+	if err := q.Err(); err != nil {
+		return fmt.Errorf("invalid mutation: %s", err)
+	}
+	base := filepath.Join(wl.dir, fmt.Sprintf("worker%02d-round%06d", worker, round))
+	var query string
+	if len(q.upsertIDs) > 0 {
+		query = q.upsertQuery() + "\n"
+	}
+	var files map[string]string
+	if wl.encoding == encodingJSON {
+		req, err := q.JSONRequest()
+		if err != nil {
+			return err
+		}
+		mu := req.Mutations[0]
+		files = map[string]string{
+			base + ".dql":      query,
+			base + ".json":     string(mu.SetJson),
+			base + ".del.json": string(mu.DeleteJson),
+		}
+	} else {
+		set, err := q.SetRDF()
+		if err != nil {
+			return err
+		}
+		del, err := q.DelRDF()
+		if err != nil {
+			return err
+		}
+		files = map[string]string{
+			base + ".dql":     query,
+			base + ".rdf":     set,
+			base + ".del.rdf": del,
+		}
+	}
+	for path, content := range files {
+		if content == "" {
+			continue
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("unable to write round file: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmitWorkload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dgraph-stress-test-emit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := testConfig{nodeTypeCount: 2, nodePredCount: 1, predStringLen: 8}
+	wl, err := newEmitWorkload(newFullyConnectedGenerator(cfg), buildSchema(2, 1), dir, encodingNQuads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := wl.Do(context.Background(), newWorker(1, 1), 3)
+	if res.err != nil {
+		t.Fatalf("unexpected error: %s", res.err)
+	}
+
+	rdf, err := ioutil.ReadFile(filepath.Join(dir, "worker01-round000003.rdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(rdf), " .\n"); n != res.quads.Size() {
+		t.Errorf("expected %d quads, got %d", res.quads.Size(), n)
+	}
+	query, err := ioutil.ReadFile(filepath.Join(dir, "worker01-round000003.dql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(query), `qu0(func: eq(name, "Node-1.3.0"))`) {
+		t.Errorf("expected the upsert queries in the order they were added, got:\n%s", query)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "worker01-round000003.del.rdf")); !os.IsNotExist(err) {
+		t.Errorf("expected no del file, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, emitSchemaFile)); err != nil {
+		t.Errorf("expected a schema file: %s", err)
+	}
+}
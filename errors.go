@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	dgo "github.com/dgraph-io/dgo/v200"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorCategory classifies the errors returned by dgraph operations and
+// decides how they are retried.
+type ErrorCategory string
+
+const (
+	// ErrAborted is a transaction aborted by a conflict; it is retried.
+	ErrAborted ErrorCategory = "aborted"
+	// ErrUnavailable is a broken or unhealthy connection; it is retried
+	// after reopening the connection.
+	ErrUnavailable ErrorCategory = "unavailable"
+	// ErrDeadline is a server side deadline; it is retried unless the
+	// caller's context is done.
+	ErrDeadline ErrorCategory = "deadline"
+	// ErrInvalidSchema is a schema or request rejected by dgraph as invalid;
+	// it is not retried.
+	ErrInvalidSchema ErrorCategory = "invalid-schema"
+	// ErrTokenExpired is an expired ACL token; it is retried after logging
+	// in again.
+	ErrTokenExpired ErrorCategory = "token-expired"
+	// ErrPermanent is any other error; it is not retried.
+	ErrPermanent ErrorCategory = "permanent"
+)
+
+// Retryable returns true if operations failing with errors of this category
+// should be retried.
+func (c ErrorCategory) Retryable() bool {
+	return c == ErrAborted || c == ErrUnavailable || c == ErrDeadline || c == ErrTokenExpired
+}
+
+// OpError is returned by the GraphConnection operations when they fail.
+type OpError struct {
+	Op       string
+	Category ErrorCategory
+	Attempts int
+	Err      error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("unable to perform dgraph %s in %d attempts (%s): %s", e.Op, e.Attempts, e.Category, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCategoryOf returns the category of an error returned by a
+// GraphConnection operation, classifying it if it is not an OpError.
+func ErrorCategoryOf(err error) ErrorCategory {
+	var opErr *OpError
+	if errors.As(err, &opErr) {
+		return opErr.Category
+	}
+	return classifyError(err)
+}
+
+// classifyError returns the category of an error returned by dgo, based on
+// the dgo sentinel errors and the gRPC status code of the error.
+func classifyError(err error) ErrorCategory {
+	switch {
+	case errors.Is(err, dgo.ErrAborted):
+		return ErrAborted
+	case errors.Is(err, dgo.ErrFinished), errors.Is(err, dgo.ErrReadOnly):
+		return ErrPermanent
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrDeadline
+	case errors.Is(err, context.Canceled):
+		return ErrPermanent
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return ErrPermanent
+	}
+	switch s.Code() {
+	case codes.Aborted:
+		return ErrAborted
+	case codes.Unavailable:
+		return ErrUnavailable
+	case codes.DeadlineExceeded:
+		return ErrDeadline
+	case codes.InvalidArgument:
+		return ErrInvalidSchema
+	case codes.Unauthenticated:
+		if strings.Contains(strings.ToLower(s.Message()), "token is expired") {
+			return ErrTokenExpired
+		}
+	case codes.Unknown:
+		return classifyUnknown(s.Message())
+	}
+	return ErrPermanent
+}
+
+// invalidSchemaMessages are parts of the messages of the errors dgraph returns
+// without a gRPC status code for an invalid schema, or for a request that does
+// not match the schema.
+var invalidSchemaMessages = []string{
+	"while lexing",
+	"invalid schema",
+	"schema change not allowed",
+	"undefined type",
+	"invalid tokenizer",
+	"input for predicate",
+	"is not indexed",
+}
+
+// classifyUnknown classifies the errors that dgraph returns without a gRPC
+// status code, which only differ by their message.
+func classifyUnknown(msg string) ErrorCategory {
+	msg = strings.ToLower(msg)
+	if strings.Contains(msg, "less than mints") || strings.Contains(msg, "transaction is too old") {
+		return ErrAborted
+	}
+	if strings.Contains(msg, "unhealthy connection") {
+		return ErrUnavailable
+	}
+	for _, m := range invalidSchemaMessages {
+		if strings.Contains(msg, m) {
+			return ErrInvalidSchema
+		}
+	}
+	return ErrPermanent
+}
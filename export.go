@@ -0,0 +1,85 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// exportGraph writes the quads of every worker round of a test to w in RDF
+// format, with blank nodes instead of upserts so that the graph can be loaded
+// with the dgraph live and bulk loaders. The blank nodes of each round are
+// prefixed with the worker and round, so that the rounds of static tests
+// create distinct nodes as they do when sent as separate mutations.
+func exportGraph(gen Generator, cfg testConfig, seed int64, w io.Writer) (rounds, quads int64, err error) {
+	workers := cfg.workers
+	if workers < 1 {
+		workers = 1
+	}
+	for id := 0; id < workers; id++ {
+		wk := newWorker(id, seed)
+		for round := 0; round < splitRounds(cfg.rounds, workers, id); round++ {
+			buildRound(gen, wk, round)
+			if err := wk.quads.Err(); err != nil {
+				return rounds, quads, fmt.Errorf("invalid mutation in worker %d round %d: %s", id, round, err)
+			}
+			nqs := wk.quads.BlankNodeQuads(fmt.Sprintf("%d.%d.", id, round))
+			rdf, err := nquadsRDF(nqs)
+			if err != nil {
+				return rounds, quads, err
+			}
+			if _, err := io.WriteString(w, rdf); err != nil {
+				return rounds, quads, err
+			}
+			rounds++
+			quads += int64(len(nqs))
+		}
+	}
+	return rounds, quads, nil
+}
+
+// exportTest writes the graph of a test to a gzip-compressed RDF file and its
+// schema to a schema file in dir, both named after the test.
+func exportTest(tc *testCommand, cfg testConfig, seed int64, dir string) error {
+	if cfg.rounds <= 0 {
+		return fmt.Errorf("the number of rounds to export must be positive")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create export directory: %s", err)
+	}
+	schemaPath := filepath.Join(dir, tc.name+".schema")
+	schema := buildSchema(cfg.nodeTypeCount, cfg.nodePredCount)
+	if err := ioutil.WriteFile(schemaPath, []byte(schema), 0644); err != nil {
+		return fmt.Errorf("unable to write schema file: %s", err)
+	}
+
+	rdfPath := filepath.Join(dir, tc.name+".rdf.gz")
+	f, err := os.Create(rdfPath)
+	if err != nil {
+		return fmt.Errorf("unable to create RDF file: %s", err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+
+	startTime := time.Now()
+	cfg.seed = seed
+	gen := tc.newGenerator(cfg)
+	fmt.Printf("# Export %s; %d workers; seed %d\n", gen.Header(), cfg.workers, seed)
+	rounds, quads, err := exportGraph(gen, cfg, seed, zw)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write RDF file: %s", err)
+	}
+	fmt.Printf("# %s\n", sanitizer.Summary())
+	fmt.Printf("# Exported %d rounds; %d quads to %s and %s in %d ms\n", rounds, quads, rdfPath, schemaPath, time.Since(startTime).Milliseconds())
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportGraph(t *testing.T) {
+	cfg := testConfig{nodeTypeCount: 2, nodePredCount: 1, predStringLen: 8, rounds: 3, workers: 2}
+	var buf bytes.Buffer
+	rounds, quads, err := exportGraph(newFullyConnectedGenerator(cfg), cfg, 1, &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rounds != 3 {
+		t.Errorf("expected 3 rounds, got %d", rounds)
+	}
+	rdf := buf.String()
+	if n := strings.Count(rdf, " .\n"); int64(n) != quads {
+		t.Errorf("expected %d quads, got %d", quads, n)
+	}
+	if strings.Contains(rdf, "uid(") {
+		t.Errorf("expected no upsert variables, got:\n%s", rdf)
+	}
+	// The next node of round 0 is the first node of round 1.
+	for _, want := range []string{"_:Node-0.0.0 <NEXT> _:Node-0.1.0 .\n", "_:Node-0.1.0 <NEXT> _:Node-0.2.0 .\n", "_:Node-1.0.0 <name>"} {
+		if !strings.Contains(rdf, want) {
+			t.Errorf("expected the RDF to contain %q, got:\n%s", want, rdf)
+		}
+	}
+}
+
+func TestExportGraphStatic(t *testing.T) {
+	cfg := testConfig{nodeTypeCount: 1, nodePredCount: 1, predStringLen: 8, rounds: 2, workers: 1}
+	var buf bytes.Buffer
+	if _, _, err := exportGraph(newSubgraphsGenerator(cfg), cfg, 1, &buf); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rdf := buf.String()
+	for _, want := range []string{"_:0.0.0 <LINK0> _:0.0.0 .\n", "_:0.1.0 <LINK0> _:0.1.0 .\n"} {
+		if !strings.Contains(rdf, want) {
+			t.Errorf("expected distinct blank nodes per round, got:\n%s", rdf)
+		}
+	}
+}
+
+func TestExportGraphSeed(t *testing.T) {
+	cfg := testConfig{nodeTypeCount: 2, nodePredCount: 2, predStringLen: 8, rounds: 2, workers: 2}
+	export := func(seed int64) string {
+		var buf bytes.Buffer
+		if _, _, err := exportGraph(newUnconnectedGenerator(cfg), cfg, seed, &buf); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return buf.String()
+	}
+	if a, b := export(7), export(7); a != b {
+		t.Errorf("expected the same graph from the same seed, got:\n%s\nand:\n%s", a, b)
+	}
+	if a, b := export(7), export(8); a == b {
+		t.Errorf("expected different graphs from different seeds, got:\n%s", a)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeDgraph is an in-process dgraph alpha stand-in. It records the requests
+// it receives, answers them with canned responses, and returns the errors
+// queued with failNext instead of answering.
+type fakeDgraph struct {
+	dgoapi.UnimplementedDgraphServer
+
+	mu        sync.Mutex
+	lastTs    uint64
+	queryJSON []byte             // returned by read-only queries
+	faults    map[string][]error // errors returned by the next calls, by method name
+	logins    []*dgoapi.LoginRequest
+	requests  []*dgoapi.Request
+	alters    []*dgoapi.Operation
+	commits   []*dgoapi.TxnContext
+	versions  int
+}
+
+func newFakeDgraph() *fakeDgraph {
+	return &fakeDgraph{queryJSON: []byte("{}"), faults: make(map[string][]error)}
+}
+
+// failNext makes the next calls to method fail with errs, one per call.
+func (f *fakeDgraph) failNext(method string, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[method] = append(f.faults[method], errs...)
+}
+
+// setQueryJSON sets the JSON returned by read-only queries.
+func (f *fakeDgraph) setQueryJSON(json string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queryJSON = []byte(json)
+}
+
+// fault pops the next queued error of a method. The caller must hold f.mu.
+func (f *fakeDgraph) fault(method string) error {
+	errs := f.faults[method]
+	if len(errs) == 0 {
+		return nil
+	}
+	f.faults[method] = errs[1:]
+	return errs[0]
+}
+
+func (f *fakeDgraph) nextTs() uint64 {
+	f.lastTs++
+	return f.lastTs
+}
+
+func (f *fakeDgraph) Login(ctx context.Context, req *dgoapi.LoginRequest) (*dgoapi.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logins = append(f.logins, req)
+	if err := f.fault("Login"); err != nil {
+		return nil, err
+	}
+	jwt := &dgoapi.Jwt{AccessJwt: fmt.Sprintf("access-%d", len(f.logins)), RefreshJwt: fmt.Sprintf("refresh-%d", len(f.logins))}
+	b, err := jwt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &dgoapi.Response{Json: b}, nil
+}
+
+func (f *fakeDgraph) Query(ctx context.Context, req *dgoapi.Request) (*dgoapi.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if err := f.fault("Query"); err != nil {
+		return nil, err
+	}
+	txn := &dgoapi.TxnContext{StartTs: req.StartTs}
+	if txn.StartTs == 0 {
+		txn.StartTs = f.nextTs()
+	}
+	resp := &dgoapi.Response{Txn: txn}
+	if len(req.Mutations) == 0 {
+		resp.Json = f.queryJSON
+		return resp, nil
+	}
+
+	// Assign a uid to every blank node, as dgraph does.
+	resp.Uids = make(map[string]string)
+	for _, mu := range req.Mutations {
+		for _, nq := range mu.Set {
+			if strings.HasPrefix(nq.Subject, "_:") {
+				if _, ok := resp.Uids[nq.Subject[2:]]; !ok {
+					resp.Uids[nq.Subject[2:]] = fmt.Sprintf("0x%x", len(resp.Uids)+1)
+				}
+			}
+		}
+	}
+	if req.CommitNow {
+		txn.CommitTs = f.nextTs()
+	}
+	return resp, nil
+}
+
+func (f *fakeDgraph) Alter(ctx context.Context, op *dgoapi.Operation) (*dgoapi.Payload, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.alters = append(f.alters, op)
+	if err := f.fault("Alter"); err != nil {
+		return nil, err
+	}
+	return &dgoapi.Payload{}, nil
+}
+
+func (f *fakeDgraph) CommitOrAbort(ctx context.Context, txn *dgoapi.TxnContext) (*dgoapi.TxnContext, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commits = append(f.commits, txn)
+	if err := f.fault("CommitOrAbort"); err != nil {
+		return nil, err
+	}
+	resp := &dgoapi.TxnContext{StartTs: txn.StartTs, Aborted: txn.Aborted}
+	if !txn.Aborted {
+		resp.CommitTs = f.nextTs()
+	}
+	return resp, nil
+}
+
+func (f *fakeDgraph) CheckVersion(ctx context.Context, c *dgoapi.Check) (*dgoapi.Version, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.versions++
+	if err := f.fault("CheckVersion"); err != nil {
+		return nil, err
+	}
+	return &dgoapi.Version{Tag: "v20.07.0-fake"}, nil
+}
+
+// Requests returns the queries and mutations received so far.
+func (f *fakeDgraph) Requests() []*dgoapi.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*dgoapi.Request(nil), f.requests...)
+}
+
+// Alters returns the schema alters received so far.
+func (f *fakeDgraph) Alters() []*dgoapi.Operation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*dgoapi.Operation(nil), f.alters...)
+}
+
+// Logins returns the login requests received so far.
+func (f *fakeDgraph) Logins() []*dgoapi.LoginRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*dgoapi.LoginRequest(nil), f.logins...)
+}
+
+// fakeServer serves a fakeDgraph over an in-memory listener.
+type fakeServer struct {
+	*fakeDgraph
+	lis   *bufconn.Listener
+	srv   *grpc.Server
+	dials int32
+}
+
+func startFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	fs := &fakeServer{
+		fakeDgraph: newFakeDgraph(),
+		lis:        bufconn.Listen(1 << 20),
+		srv:        grpc.NewServer(),
+	}
+	dgoapi.RegisterDgraphServer(fs.srv, fs.fakeDgraph)
+	go fs.srv.Serve(fs.lis)
+	t.Cleanup(fs.srv.Stop)
+	return fs
+}
+
+// connOptions returns connection options that dial the fake server and
+// retry without waiting.
+func (fs *fakeServer) connOptions() ConnOptions {
+	opts := DefaultConnOptions()
+	opts.Retry = RetryPolicy{InitialDelay: time.Millisecond, Multiplier: 1, MaxAttempts: 3}
+	opts.ReconnectDelay = 0
+	opts.Dialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		atomic.AddInt32(&fs.dials, 1)
+		return fs.lis.Dial()
+	}
+	return opts
+}
+
+// Dials returns the number of connections dialed to the fake server.
+func (fs *fakeServer) Dials() int {
+	return int(atomic.LoadInt32(&fs.dials))
+}
+
+// connect opens a GraphConnection to the fake server.
+func (fs *fakeServer) connect(t *testing.T, opts ConnOptions) *GraphConnection {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	gc, err := NewGraphConnection(ctx, []string{"bufconn"}, opts, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unable to connect to fake dgraph: %s", err)
+	}
+	t.Cleanup(gc.Close)
+	return gc
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Generator builds the mutation sent by a worker in each round of a test.
+type Generator interface {
+	// Header returns the description printed at the start of the test.
+	Header() string
+	// Static returns true if the quads built for round 0 should be sent
+	// again in every following round instead of being rebuilt.
+	Static() bool
+	// Round adds the quads for the given worker round to q, drawing the
+	// random data from the worker's rng.
+	Round(q *Quads, rng *rand.Rand, worker, round int)
+	// NodeName returns the name of the node of type i written by a worker
+	// in a round.
+	NodeName(worker, round, i int) string
+}
+
+// writeWorkload sends the quads built by a generator in every round.
+type writeWorkload struct {
+	dgc *GraphConnection
+	gen Generator
+}
+
+func newWriteWorkload(dgc *GraphConnection, gen Generator) *writeWorkload {
+	return &writeWorkload{dgc: dgc, gen: gen}
+}
+
+func (wl *writeWorkload) Header() string {
+	return wl.gen.Header()
+}
+
+func (wl *writeWorkload) Do(ctx context.Context, w *worker, round int) opResult {
+	buildRound(wl.gen, w, round)
+
+	startTime := time.Now()
+	err := wl.dgc.Mutate(ctx, w.quads)
+	endTime := time.Now()
+	return opResult{op: "write", quads: w.quads, latency: endTime.Sub(startTime), err: err}
+}
+
+// buildRound builds the quads of a worker round in w.quads, reusing the quads
+// of the previous round for static generators.
+func buildRound(gen Generator, w *worker, round int) {
+	if !gen.Static() || w.quads.Size() == 0 {
+		w.quads.Clear()
+		gen.Round(w.quads, w.rng, w.id, round)
+	}
+}
+
+// nodeName returns the name of the node of type i created by a worker in a
+// round, so that concurrent workers never upsert each other's nodes.
+func nodeName(worker, round, i int) string {
+	return fmt.Sprintf("Node-%d.%d.%d", worker, round, i)
+}
+
+// Creates graph with unconnected nodes
+type unconnectedGenerator struct {
+	cfg testConfig
+}
+
+func newUnconnectedGenerator(cfg testConfig) Generator {
+	return &unconnectedGenerator{cfg: cfg}
+}
+
+func (g *unconnectedGenerator) Header() string {
+	return fmt.Sprintf("Test Unconnnected: %d rounds; %d node types; %d predicates", g.cfg.rounds, g.cfg.nodeTypeCount, g.cfg.nodePredCount)
+}
+
+func (g *unconnectedGenerator) Static() bool {
+	return true
+}
+
+func (g *unconnectedGenerator) NodeName(worker, round, i int) string {
+	return fmt.Sprintf("Node%d", i)
+}
+
+func (g *unconnectedGenerator) Round(q *Quads, rng *rand.Rand, worker, round int) {
+	for i := 0; i < g.cfg.nodeTypeCount; i++ {
+		subj := fmt.Sprintf("_:%d", i)
+		q.SetQuadStr(subj, "dgraph.type", fmt.Sprintf("Node%d", i))
+		q.SetQuadStr(subj, "name", fmt.Sprintf("Node%d", i))
+		for j := 0; j < g.cfg.nodePredCount; j++ {
+			q.SetQuadStr(subj, fmt.Sprintf("pred%d", j), randomString(rng, g.cfg.predStringLen))
+		}
+	}
+}
+
+// Creates graph with multiple fully connected subgraphs that are not connected
+// to one another
+type subgraphsGenerator struct {
+	cfg testConfig
+}
+
+func newSubgraphsGenerator(cfg testConfig) Generator {
+	return &subgraphsGenerator{cfg: cfg}
+}
+
+func (g *subgraphsGenerator) Header() string {
+	return fmt.Sprintf("Test Connnected Subgraphs: %d rounds; %d node types; %d predicates", g.cfg.rounds, g.cfg.nodeTypeCount, g.cfg.nodePredCount)
+}
+
+func (g *subgraphsGenerator) Static() bool {
+	return true
+}
+
+func (g *subgraphsGenerator) NodeName(worker, round, i int) string {
+	return fmt.Sprintf("Node%d", i)
+}
+
+func (g *subgraphsGenerator) Round(q *Quads, rng *rand.Rand, worker, round int) {
+	for i := 0; i < g.cfg.nodeTypeCount; i++ {
+		subj := fmt.Sprintf("_:%d", i)
+		q.SetQuadStr(subj, "dgraph.type", fmt.Sprintf("Node%d", i))
+		q.SetQuadStr(subj, "name", fmt.Sprintf("Node%d", i))
+		for j := 0; j < g.cfg.nodePredCount; j++ {
+			q.SetQuadStr(subj, fmt.Sprintf("pred%d", j), randomString(rng, g.cfg.predStringLen))
+		}
+		for k := 0; k < g.cfg.nodeTypeCount; k++ {
+			q.SetQuadRel(subj, fmt.Sprintf("LINK%d", k), fmt.Sprintf("_:%d", k))
+		}
+	}
+}
+
+// Creates graph with multiple fully connected subgraphs which are connected
+// to one another
+type fullyConnectedGenerator struct {
+	cfg testConfig
+}
+
+func newFullyConnectedGenerator(cfg testConfig) Generator {
+	return &fullyConnectedGenerator{cfg: cfg}
+}
+
+func (g *fullyConnectedGenerator) Header() string {
+	return fmt.Sprintf("Test Fully Connnected: %d rounds; %d node types; %d predicates of %d length", g.cfg.rounds, g.cfg.nodeTypeCount, g.cfg.nodePredCount, g.cfg.predStringLen)
+}
+
+func (g *fullyConnectedGenerator) Static() bool {
+	return false
+}
+
+func (g *fullyConnectedGenerator) NodeName(worker, round, i int) string {
+	return nodeName(worker, round, i)
+}
+
+func (g *fullyConnectedGenerator) Round(q *Quads, rng *rand.Rand, worker, round int) {
+	for i := 0; i < g.cfg.nodeTypeCount; i++ {
+		name := nodeName(worker, round, i)
+		nodeType := fmt.Sprintf("Node%d", i)
+		upsertIDCurrent := q.AddUpsertQuery("name", name, nodeType)
+
+		q.SetQuadStrUpsert(upsertIDCurrent, "dgraph.type", nodeType)
+		q.SetQuadStrUpsert(upsertIDCurrent, "name", name)
+		for j := 0; j < g.cfg.nodePredCount; j++ {
+			q.SetQuadStrUpsert(upsertIDCurrent, fmt.Sprintf("pred%d", j), lessRandomString(rng, g.cfg.predStringLen))
+		}
+
+		if i == 0 {
+			nodeNamePlus1 := nodeName(worker, round+1, i)
+			upsertIDPlus1 := q.AddUpsertQuery("name", nodeNamePlus1, nodeType)
+			q.SetQuadStrUpsert(upsertIDPlus1, "dgraph.type", nodeType)
+			q.SetQuadStrUpsert(upsertIDPlus1, "name", nodeNamePlus1)
+			q.SetQuadRelUpsertFromTo(upsertIDCurrent, "NEXT", upsertIDPlus1)
+		}
+
+		for k := 0; k < g.cfg.nodeTypeCount; k++ {
+			upsertIDLink := q.AddUpsertQuery("name", nodeName(worker, round, k), fmt.Sprintf("Node%d", k))
+			q.SetQuadRelUpsertFromTo(upsertIDCurrent, fmt.Sprintf("LINK%d", k), upsertIDLink)
+		}
+	}
+}
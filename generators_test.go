@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestGeneratorQuads(t *testing.T) {
+	cfg := testConfig{nodeTypeCount: 3, nodePredCount: 2, predStringLen: 8, edgesPerNode: 2}
+	tests := []struct {
+		name    string
+		gen     Generator
+		static  bool
+		quads   int
+		upserts bool
+	}{
+		// type, name and predicates for each node
+		{"unconnected", newUnconnectedGenerator(cfg), true, 3 * 4, false},
+		// plus a link to every node
+		{"subgraphs", newSubgraphsGenerator(cfg), true, 3 * 7, false},
+		// plus the type, name and NEXT edge of the next round's first node
+		{"fully-connected", newFullyConnectedGenerator(cfg), false, 3*7 + 3, true},
+		// plus an edge from the second node to the first, and two from the third
+		{"scale-free", newScaleFreeGenerator(cfg), false, 3*4 + 3, true},
+	}
+	for _, tt := range tests {
+		q := NewQuads()
+		tt.gen.Round(q, rand.New(rand.NewSource(1)), 1, 2)
+		if tt.gen.Static() != tt.static {
+			t.Errorf("%s: expected static %t", tt.name, tt.static)
+		}
+		if q.Size() != tt.quads {
+			t.Errorf("%s: expected %d quads, got %d", tt.name, tt.quads, q.Size())
+		}
+		if hasQuery := q.Request().Query != ""; hasQuery != tt.upserts {
+			t.Errorf("%s: expected upsert query %t, got %t", tt.name, tt.upserts, hasQuery)
+		}
+	}
+}
+
+func TestFullyConnectedNodeNames(t *testing.T) {
+	gen := newFullyConnectedGenerator(testConfig{nodeTypeCount: 2, nodePredCount: 1, predStringLen: 8})
+	q := NewQuads()
+	gen.Round(q, rand.New(rand.NewSource(1)), 1, 2)
+	query := q.Request().Query
+	for _, name := range []string{gen.NodeName(1, 2, 0), gen.NodeName(1, 2, 1), gen.NodeName(1, 3, 0)} {
+		if !strings.Contains(query, `"`+name+`"`) {
+			t.Errorf("expected the upsert query to contain node %s, got:\n%s", name, query)
+		}
+	}
+	if gen.NodeName(0, 2, 0) == gen.NodeName(1, 2, 0) {
+		t.Error("expected workers to write distinct nodes")
+	}
+}
+
+func TestWriteWorkload(t *testing.T) {
+	fs := startFakeServer(t)
+	gc := fs.connect(t, fs.connOptions())
+
+	for _, tc := range testCommands {
+		cfg := testConfig{nodeTypeCount: 2, nodePredCount: 2, predStringLen: 8, rounds: 5, workers: 2}
+		before := len(fs.Requests())
+		r := newRunner(newWriteWorkload(gc, tc.newGenerator(cfg)), cfg)
+		rc := runContexts{stop: context.Background(), ops: context.Background()}
+		if err := r.Run(rc); err != nil {
+			t.Fatalf("%s: unexpected error: %s", tc.name, err)
+		}
+		if r.totalRounds != 5 {
+			t.Errorf("%s: expected 5 rounds, got %d", tc.name, r.totalRounds)
+		}
+		reqs := fs.Requests()[before:]
+		if len(reqs) != 5 {
+			t.Fatalf("%s: expected 5 requests, got %d", tc.name, len(reqs))
+		}
+		for _, req := range reqs {
+			if len(req.Mutations) != 1 || len(req.Mutations[0].Set) == 0 {
+				t.Errorf("%s: expected a mutation, got %v", tc.name, req)
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+)
+
+// Encodings of the mutations sent to dgraph.
+const (
+	encodingNQuads = "nquads"
+	encodingJSON   = "json"
+)
+
+// JSONRequest returns the dgraph request to perform the mutations, with the
+// quads encoded as JSON objects instead of N-Quads.
+func (q *Quads) JSONRequest() (*dgoapi.Request, error) {
+	mu := &dgoapi.Mutation{CommitNow: true}
+	var err error
+	if len(q.setQuads) > 0 {
+		if mu.SetJson, err = quadsJSON(q.setQuads, false); err != nil {
+			return nil, fmt.Errorf("unable to encode set quads as JSON: %s", err)
+		}
+	}
+	if len(q.delQuads) > 0 {
+		if mu.DeleteJson, err = quadsJSON(q.delQuads, true); err != nil {
+			return nil, fmt.Errorf("unable to encode del quads as JSON: %s", err)
+		}
+	}
+	req := &dgoapi.Request{
+		Mutations: []*dgoapi.Mutation{mu},
+		CommitNow: true,
+	}
+	if len(q.upsertIDs) > 0 {
+		req.Query = q.upsertQuery()
+	}
+	return req, nil
+}
+
+// quadsJSON encodes quads as a JSON array with an object per subject, in the
+// order the subjects first appear. Edges are nested objects holding the uid
+// of the object node, and facets are "predicate|key" fields. When deleting, a
+// star value is encoded as null, and a star predicate as an object with the
+// uid only, which deletes all the predicates of the node.
+func quadsJSON(nqs []*dgoapi.NQuad, del bool) ([]byte, error) {
+	var objects []map[string]interface{}
+	nodes := make(map[string]map[string]interface{})
+	for _, nq := range nqs {
+		obj, ok := nodes[nq.Subject]
+		if !ok {
+			obj = map[string]interface{}{"uid": jsonUID(nq.Subject)}
+			nodes[nq.Subject] = obj
+			objects = append(objects, obj)
+		}
+		if del && nq.Predicate == "*" {
+			continue
+		}
+
+		pred := nq.Predicate
+		if nq.Lang != "" {
+			pred += "@" + nq.Lang
+		}
+		if nq.ObjectId != "" {
+			edge := map[string]interface{}{"uid": jsonUID(nq.ObjectId)}
+			for _, f := range nq.Facets {
+				edge[pred+"|"+f.Key] = facetValue(f)
+			}
+			addJSONValue(obj, pred, edge)
+			continue
+		}
+		if del && nq.ObjectValue.GetDefaultVal() == "_STAR_ALL" {
+			obj[pred] = nil
+			continue
+		}
+		val, err := jsonValue(nq.ObjectValue)
+		if err != nil {
+			return nil, fmt.Errorf("predicate %s of %s: %s", nq.Predicate, nq.Subject, err)
+		}
+		addJSONValue(obj, pred, val)
+		for _, f := range nq.Facets {
+			obj[pred+"|"+f.Key] = facetValue(f)
+		}
+	}
+	return json.Marshal(objects)
+}
+
+// addJSONValue sets a predicate of a JSON object, turning it into a list when
+// the predicate has several values.
+func addJSONValue(obj map[string]interface{}, pred string, val interface{}) {
+	prev, ok := obj[pred]
+	if !ok {
+		obj[pred] = val
+		return
+	}
+	if list, ok := prev.([]interface{}); ok {
+		obj[pred] = append(list, val)
+		return
+	}
+	obj[pred] = []interface{}{prev, val}
+}
+
+// jsonUID returns the JSON uid of a node: blank nodes and uid variables are
+// kept as is, and uids lose the angle brackets of their RDF form.
+func jsonUID(node string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(node, "<"), ">")
+}
+
+// jsonValue returns the JSON value of a quad value. Datetimes and dates are
+// encoded as RFC 3339 strings, bytes as base64 strings and uids as edges. Geo
+// values, held in binary (WKB) form, are not supported.
+func jsonValue(v *dgoapi.Value) (interface{}, error) {
+	switch val := v.GetVal().(type) {
+	case *dgoapi.Value_StrVal:
+		return val.StrVal, nil
+	case *dgoapi.Value_IntVal:
+		return val.IntVal, nil
+	case *dgoapi.Value_BoolVal:
+		return val.BoolVal, nil
+	case *dgoapi.Value_DoubleVal:
+		return val.DoubleVal, nil
+	case *dgoapi.Value_DefaultVal:
+		return val.DefaultVal, nil
+	case *dgoapi.Value_PasswordVal:
+		return val.PasswordVal, nil
+	case *dgoapi.Value_BytesVal:
+		return base64.StdEncoding.EncodeToString(val.BytesVal), nil
+	case *dgoapi.Value_DatetimeVal:
+		return binaryTime(val.DatetimeVal)
+	case *dgoapi.Value_DateVal:
+		return binaryTime(val.DateVal)
+	case *dgoapi.Value_UidVal:
+		return map[string]interface{}{"uid": fmt.Sprintf("%#x", val.UidVal)}, nil
+	case nil:
+		return nil, fmt.Errorf("missing value")
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", val)
+	}
+}
+
+// binaryTime returns the RFC 3339 form of a time in the binary form of the
+// dgraph datetime values.
+func binaryTime(b []byte) (string, error) {
+	var t time.Time
+	if err := t.UnmarshalBinary(b); err != nil {
+		return "", fmt.Errorf("invalid datetime value: %s", err)
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
+
+// facetValue decodes the value of a facet, which dgraph stores in binary form
+// for numbers and booleans.
+func facetValue(f *dgoapi.Facet) interface{} {
+	switch f.ValType {
+	case dgoapi.Facet_INT:
+		if len(f.Value) == 8 {
+			return int64(binary.LittleEndian.Uint64(f.Value))
+		}
+	case dgoapi.Facet_FLOAT:
+		if len(f.Value) == 8 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(f.Value))
+		}
+	case dgoapi.Facet_BOOL:
+		if len(f.Value) == 1 {
+			return f.Value[0] != 0
+		}
+	}
+	return string(f.Value)
+}
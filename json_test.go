@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+)
+
+func decodeJSON(t *testing.T, b []byte) []map[string]interface{} {
+	t.Helper()
+	var objects []map[string]interface{}
+	if err := json.Unmarshal(b, &objects); err != nil {
+		t.Fatalf("invalid JSON %s: %s", b, err)
+	}
+	return objects
+}
+
+func TestJSONRequest(t *testing.T) {
+	q := NewQuads()
+	id := q.AddUpsertQuery("name", "a", "Node0")
+	q.SetQuadStrUpsert(id, "name", "a", CreateFacetString("source", "test"))
+	q.SetQuadInt64("_:b", "count", 3)
+	q.SetQuadBool("_:b", "ok", true)
+	q.SetQuadRel("_:b", "LINK0", "_:c")
+	q.SetQuadRel("_:b", "LINK0", "_:d")
+	q.SetQuadRelUpsertTo("_:b", "LINK1", id)
+
+	req, err := q.JSONRequest()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if req.Query == "" || !req.CommitNow {
+		t.Errorf("expected an upsert request committed now, got %v", req)
+	}
+	mu := req.Mutations[0]
+	if len(mu.Set) != 0 || len(mu.DeleteJson) != 0 {
+		t.Errorf("expected JSON set quads only, got %v", mu)
+	}
+	want := []map[string]interface{}{
+		{"uid": "uid(upsert_id_0)", "name": "a", "name|source": "test"},
+		{
+			"uid":   "_:b",
+			"count": 3.0,
+			"ok":    true,
+			"LINK0": []interface{}{map[string]interface{}{"uid": "_:c"}, map[string]interface{}{"uid": "_:d"}},
+			"LINK1": map[string]interface{}{"uid": "uid(upsert_id_0)"},
+		},
+	}
+	if got := decodeJSON(t, mu.SetJson); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestJSONRequestDelete(t *testing.T) {
+	q := NewQuads()
+	q.DelQuadProp("<0x1>", "name")
+	q.DelQuadRel("<0x1>", "LINK0", "<0x2>")
+	q.DelQuadNodeUpsert(q.AddUpsertQuery("name", "a", "Node0"))
+
+	req, err := q.JSONRequest()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []map[string]interface{}{
+		{"uid": "0x1", "name": nil, "LINK0": map[string]interface{}{"uid": "0x2"}},
+		{"uid": "uid(upsert_id_0)"},
+	}
+	if got := decodeJSON(t, req.Mutations[0].DeleteJson); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestJSONRequestValueTypes(t *testing.T) {
+	q := NewQuads()
+	set := `_:a <when> "2020-08-01T10:00:00Z"^^<xs:dateTime> .
+_:a <blob> "AAH/"^^<xs:base64Binary> .
+`
+	if err := q.LoadRDF(set, ""); err != nil {
+		t.Fatal(err)
+	}
+	q.setQuads = append(q.setQuads, &dgoapi.NQuad{Subject: "_:a", Predicate: "LINK0", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_UidVal{UidVal: 42}}})
+	req, err := q.JSONRequest()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []map[string]interface{}{
+		{"uid": "_:a", "when": "2020-08-01T10:00:00Z", "blob": "AAH/", "LINK0": map[string]interface{}{"uid": "0x2a"}},
+	}
+	if got := decodeJSON(t, req.Mutations[0].SetJson); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	q.setQuads = append(q.setQuads, &dgoapi.NQuad{Subject: "_:a", Predicate: "loc", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_GeoVal{GeoVal: []byte{1}}}})
+	if _, err := q.JSONRequest(); err == nil {
+		t.Error("expected an error for a geo value")
+	}
+}
+
+func TestGraphConnectionMutateJSON(t *testing.T) {
+	fs := startFakeServer(t)
+	opts := fs.connOptions()
+	opts.Encoding = encodingJSON
+	gc := fs.connect(t, opts)
+
+	if err := gc.Mutate(context.Background(), testQuads()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reqs := fs.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(reqs))
+	}
+	mu := reqs[0].Mutations[0]
+	if len(mu.Set) != 0 || len(mu.SetJson) == 0 {
+		t.Errorf("expected a JSON mutation, got %v", mu)
+	}
+}
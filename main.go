@@ -4,46 +4,41 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/alecthomas/kingpin"
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
 )
 
 const (
 	dgraphTimeout = 10 * time.Minute
 )
 
-func randomString(length int) string {
+func randomString(rng *rand.Rand, length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, length)
 	for i := range b {
 		if i%8 == 0 {
 			b[i] = ' '
 		} else {
-			b[i] = charset[rand.Intn(len(charset))]
+			b[i] = charset[rng.Intn(len(charset))]
 		}
 	}
 	return string(b)
 }
 
-func lessRandomString(length int) string {
+func lessRandomString(rng *rand.Rand, length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	pos := rand.Intn(len(charset))
+	pos := rng.Intn(len(charset))
 	return strings.Repeat(string(charset[pos]), length)
 }
 
-func initDgraphConn(ctx context.Context, dgraphURLs []string, nodeTypeCount, nodePredCount int) (*GraphConnection, error) {
-	// Open connection
-	connectCtx, connectCancel := context.WithTimeout(ctx, dgraphTimeout)
-	defer connectCancel()
-	dgc, err := NewGraphConnection(connectCtx, dgraphURLs, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Load schema
+// buildSchema returns the schema of the graphs built by the tests.
+func buildSchema(nodeTypeCount, nodePredCount int) Schema {
 	var schema strings.Builder
 	for i := 0; i < nodeTypeCount; i++ {
 		schema.WriteString(fmt.Sprintf("type Node%d {\n", i))
@@ -65,144 +60,534 @@ func initDgraphConn(ctx context.Context, dgraphURLs []string, nodeTypeCount, nod
 	for k := 0; k < nodeTypeCount; k++ {
 		schema.WriteString(fmt.Sprintf("LINK%d: [uid] .\n", k))
 	}
-	fmt.Printf("Schema:\n%s\n", schema.String())
-	err = dgc.LoadSchema(ctx, Schema(schema.String()))
+	return Schema(schema.String())
+}
+
+// connOptions returns the connection options set by the flags.
+func connOptions() (ConnOptions, error) {
+	opts := DefaultConnOptions()
+	opts.Encoding = *encoding
+	opts.Retry = RetryPolicy{
+		InitialDelay: *retryInitialDelay,
+		Multiplier:   *retryMultiplier,
+		MaxDelay:     *retryMaxDelay,
+		Jitter:       *retryJitter,
+		MaxAttempts:  *retryMaxAttempts,
+		MaxElapsed:   *retryMaxElapsed,
+	}
+	if tlsOpts.Enabled() {
+		tlsConfig, err := tlsOpts.Config()
+		if err != nil {
+			return opts, err
+		}
+		opts.TLS = tlsConfig
+	}
+	if aclCreds.User != "" {
+		creds := aclCreds
+		opts.ACL = &creds
+	} else if aclCreds.Password != "" || aclCreds.Namespace != 0 {
+		return opts, fmt.Errorf("a user must be provided to log in to dgraph")
+	}
+	return opts, nil
+}
+
+func openDgraphConn(ctx context.Context, dgraphURLs []string) (*GraphConnection, error) {
+	opts, err := connOptions()
 	if err != nil {
-		return dgc, err
+		return nil, err
 	}
-	return dgc, nil
+	connectCtx, connectCancel := context.WithTimeout(ctx, dgraphTimeout)
+	defer connectCancel()
+	return NewGraphConnection(connectCtx, dgraphURLs, opts, nil)
 }
 
-// Creates graph with unconnected nodes
-func testUnconnected(ctx context.Context, dgc *GraphConnection, nodeTypeCount, nodePredCount, predStringLength, rounds int) error {
-	quads := NewQuads()
-	for i := 0; i < nodeTypeCount; i++ {
-		subj := fmt.Sprintf("_:%d", i)
-		quads.SetQuadStr(subj, "dgraph.type", fmt.Sprintf("Node%d", i))
-		quads.SetQuadStr(subj, "name", fmt.Sprintf("Node%d", i))
-		for j := 0; j < nodePredCount; j++ {
-			quads.SetQuadStr(subj, fmt.Sprintf("pred%d", j), randomString(predStringLength))
-		}
+// testConfig holds the graph shape flags shared by every test command.
+type testConfig struct {
+	nodeTypeCount int
+	nodePredCount int
+	predStringLen int
+	rounds        int
+	workers       int
+	printQuads    bool
+	edgesPerNode  int // edges of each new node of the scale-free graphs
+	// random graphs
+	meanDegree      float64
+	edgeProbability float64
+	degrees         degreeDistribution
+	seed            int64 // seed of the random graphs, set from the run seed
+}
+
+func (cfg *testConfig) registerFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("node-type-count", "set the number of node types").Default("50").IntVar(&cfg.nodeTypeCount)
+	cmd.Flag("node-pred-count", "set the number of predicates per node").Default("50").IntVar(&cfg.nodePredCount)
+	cmd.Flag("pred-string-len", "set the length of the string to store in each predicate").Default("20").IntVar(&cfg.predStringLen)
+	cmd.Flag("rounds", "set the total number of rounds to perform across all workers; 0 for no limit").Default("500000").IntVar(&cfg.rounds)
+	cmd.Flag("workers", "set the number of workers performing rounds in parallel").Default("1").IntVar(&cfg.workers)
+	cmd.Flag("print-quads", "print the quads sent in each round").BoolVar(&cfg.printQuads)
+	cmd.Flag("edges-per-node", "set the number of edges from each new node to the existing nodes of the scale-free graph").Default(strconv.Itoa(defaultEdgesPerNode)).IntVar(&cfg.edgesPerNode)
+	cmd.Flag("mean-degree", "set the mean degree of the random graph, unless --edge-probability is set").Default(strconv.Itoa(defaultMeanDegree)).Float64Var(&cfg.meanDegree)
+	cmd.Flag("edge-probability", "set the probability of an edge between any two nodes of the random graph; 0 to derive it from --mean-degree").Default("0").Float64Var(&cfg.edgeProbability)
+	cmd.Flag("degree-distribution", "set the degree distribution of the random-degree graph (fixed:D, uniform:MIN-MAX, power-law:EXPONENT)").Default(defaultDegreeDistribution).SetValue(&cfg.degrees)
+}
+
+type testCommand struct {
+	name         string
+	help         string
+	newGenerator func(cfg testConfig) Generator
+	prebuilt     bool // the generator builds the whole graph first, so the rounds must be bounded
+	cmd          *kingpin.CmdClause
+	cfg          testConfig
+}
+
+// checkConfig returns an error if the test cannot generate its graph with cfg.
+func (tc *testCommand) checkConfig(cfg testConfig) error {
+	if tc.prebuilt && cfg.rounds <= 0 {
+		return fmt.Errorf("the %s test builds its graph before the run and needs a positive number of --rounds", tc.name)
 	}
+	return nil
+}
 
-	fmt.Printf("# Test Unconnnected: %d rounds; %d node types; %d predicates\n", rounds, nodeTypeCount, nodePredCount)
-	fmt.Println("round,time (ms)")
-	for r := 0; r < rounds; r++ {
-		startTime := time.Now()
-		err := dgc.Mutate(context.Background(), quads)
-		endTime := time.Now()
-		if err != nil {
-			return err
-		}
-		fmt.Printf("%d,%d\n", r, endTime.Sub(startTime).Milliseconds())
+var testCommands = []*testCommand{
+	{name: "unconnected", help: "create a graph of unconnected nodes", newGenerator: newUnconnectedGenerator},
+	{name: "subgraphs", help: "create fully connected subgraphs that are not connected to one another", newGenerator: newSubgraphsGenerator},
+	{name: "fully-connected", help: "create fully connected subgraphs which are connected to one another", newGenerator: newFullyConnectedGenerator},
+	{name: "scale-free", help: "grow a scale-free graph by preferential attachment, where a few hub nodes get most of the edges", newGenerator: newScaleFreeGenerator},
+	{name: "random", help: "create an Erdős–Rényi random graph, where any two nodes are linked with the same probability", newGenerator: newErdosRenyiGenerator, prebuilt: true},
+	{name: "random-degree", help: "create a random graph with node degrees drawn from a distribution", newGenerator: newRandomDegreeGenerator, prebuilt: true},
+}
+
+var (
+	app            = kingpin.New("dgraph-stress-test", "create a synthetic graph")
+	dgraphAddr     = app.Flag("dgraph-addr", "set the connection string (host:port) for Dgraph DB; use multiple flags for multiple servers").Default("127.0.0.1:9080").Strings()
+	duration       = app.Flag("duration", "stop starting new rounds after this duration; 0 for no limit").Default("0").Duration()
+	gracePeriod    = app.Flag("shutdown-grace", "set how long in-flight operations may take to finish when the run stops").Default("30s").Duration()
+	outputPath     = app.Flag("output", "write machine-readable results to this file").String()
+	outputFormat   = app.Flag("output-format", "set the format of the results file (jsonl, csv)").Default(resultsJSONL).Enum(resultsJSONL, resultsCSV)
+	metricsAddr    = app.Flag("metrics-addr", "serve Prometheus metrics at /metrics on this address (host:port); disabled if empty").String()
+	seed           = app.Flag("seed", "set the seed of the generated data, so that runs with the same seed generate the same data; 0 for a random seed").Int64()
+	sanitizePolicy = app.Flag("sanitize", "set how values with characters invalid in the original RDF filter are handled (strip, escape, reject)").Default(sanitizeStrip).Enum(sanitizeStrip, sanitizeEscape, sanitizeReject)
+	rateSpec       = app.Flag("rate", "run open loop, starting rounds at this rate (e.g. 200/s) whether or not the previous rounds finished; closed loop if empty").String()
+	arrival        = app.Flag("arrival", "set the distribution of the open-loop round start times (constant, poisson)").Default(arrivalConstant).Enum(arrivalConstant, arrivalPoisson)
+	profileOpts    = newProfileConfig(app)
+	encoding       = app.Flag("encoding", "set the encoding of the mutations (nquads, json)").Default(encodingNQuads).Enum(encodingNQuads, encodingJSON)
+	dryRun         = app.Flag("dry-run", "run a test without connecting to Dgraph, writing the mutations of every round to --emit-dir").Bool()
+	recordPath     = app.Flag("record", "record the mutations sent to Dgraph to this JSON Lines file, for the replay command").String()
+	emitDir        = app.Flag("emit-dir", "set the directory the mutations are written to in a dry run").Default("emit").String()
+	listCmd        = app.Command("list", "list the available tests")
+
+	retryInitialDelay = app.Flag("retry-initial-delay", "set the delay before the first retry of a failed dgraph operation").Default(DefaultRetryPolicy.InitialDelay.String()).Duration()
+	retryMultiplier   = app.Flag("retry-multiplier", "set the factor applied to the retry delay after each retry").Default(strconv.FormatFloat(DefaultRetryPolicy.Multiplier, 'g', -1, 64)).Float64()
+	retryMaxDelay     = app.Flag("retry-max-delay", "set the maximum delay between retries; 0 for no limit").Default(DefaultRetryPolicy.MaxDelay.String()).Duration()
+	retryJitter       = app.Flag("retry-jitter", "set the fraction of the retry delay randomly added or removed (0 to 1)").Default(strconv.FormatFloat(DefaultRetryPolicy.Jitter, 'g', -1, 64)).Float64()
+	retryMaxAttempts  = app.Flag("retry-max-attempts", "set the maximum attempts of a dgraph operation, including the first; 0 for no limit").Default(strconv.Itoa(DefaultRetryPolicy.MaxAttempts)).Int()
+	retryMaxElapsed   = app.Flag("retry-max-elapsed", "set the time after which a failed dgraph operation is no longer retried; 0 for no limit").Default(DefaultRetryPolicy.MaxElapsed.String()).Duration()
+
+	tlsOpts  TLSOptions
+	aclCreds ACLCredentials
+
+	queryCmd  = app.Command("query", "query the graph created by a test")
+	queryTest testConfig
+	queryOpts queryConfig
+
+	mixedCmd  = app.Command("mixed", "write, query and delete the graph of a test with a weighted mix of operations")
+	mixedTest testConfig
+	mixedOpts queryConfig
+	mixSpec   = mixedCmd.Flag("mix", "set the weight of each operation (write, query, delete) as op=weight pairs").Default("write=70,query=25,delete=5").String()
+
+	exportCmd       = app.Command("export", "write the graph of a test to RDF and schema files for the dgraph live and bulk loaders")
+	exportGraphName = exportCmd.Flag("graph", "set the test whose graph is exported").Default("fully-connected").Enum(testNames()...)
+	exportDir       = exportCmd.Flag("dir", "set the directory the files are written to").Default("export").String()
+	exportTestCfg   testConfig
+
+	replayCmd     = app.Command("replay", "send the mutations of a recording made with --record to Dgraph again")
+	replayFile    = replayCmd.Flag("file", "set the recording to replay").Required().String()
+	replaySpeed   = replayCmd.Flag("speed", "set the pace of the replay relative to the recording, e.g. 2 for twice as fast; 0 to send the requests as fast as possible").Default("1").Float64()
+	replayWorkers = replayCmd.Flag("workers", "set the number of workers sending the requests in parallel").Default("1").Int()
+
+	proxyCmd    = app.Command("proxy", "proxy requests to the first Dgraph server, injecting faults to exercise the retry and reconnect logic")
+	proxyListen = proxyCmd.Flag("listen", "set the address (host:port) the proxy listens on").Default("127.0.0.1:9180").String()
+	proxyFaults faultConfig
+)
+
+func init() {
+	app.Flag("tls-cacert", "set the PEM file of the CA certificates used to verify the Dgraph servers; enables TLS").StringVar(&tlsOpts.CACert)
+	app.Flag("tls-cert", "set the PEM file of the client certificate for mutual TLS; enables TLS").StringVar(&tlsOpts.Cert)
+	app.Flag("tls-key", "set the PEM file of the client private key for mutual TLS; enables TLS").StringVar(&tlsOpts.Key)
+	app.Flag("tls-server-name", "override the server name used to verify the Dgraph server certificates; enables TLS").StringVar(&tlsOpts.ServerName)
+	app.Flag("user", "set the user to log in to Dgraph with when ACLs are enabled").StringVar(&aclCreds.User)
+	app.Flag("password", "set the password to log in to Dgraph with when ACLs are enabled").Envar("DGRAPH_STRESS_PASSWORD").StringVar(&aclCreds.Password)
+	app.Flag("namespace", "set the namespace to log in to when ACLs are enabled; only the default namespace 0 is supported by the Dgraph v20 client").Default("0").Uint64Var(&aclCreds.Namespace)
+
+	for _, tc := range testCommands {
+		tc.cmd = app.Command(tc.name, tc.help)
+		tc.cfg.registerFlags(tc.cmd)
 	}
 
+	queryTest.registerFlags(queryCmd)
+	queryOpts.registerFlags(queryCmd)
+	mixedTest.registerFlags(mixedCmd)
+	mixedOpts.registerFlags(mixedCmd)
+	exportTestCfg.registerFlags(exportCmd)
+	proxyFaults.registerFlags(proxyCmd)
+}
+
+func (qcfg *queryConfig) registerFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("graph", "set the test that created the graph").Default("fully-connected").EnumVar(&qcfg.graph, testNames()...)
+	cmd.Flag("graph-workers", "set the number of workers that created the graph").Default("1").IntVar(&qcfg.graphWorkers)
+	cmd.Flag("graph-rounds", "set the total number of rounds that created the graph").Default("1000").IntVar(&qcfg.graphRounds)
+	cmd.Flag("query-type", "set a query type to perform ("+strings.Join(queryTypes, ", ")+"); use multiple flags for multiple types; defaults to all").StringsVar(&qcfg.types)
+	cmd.Flag("hops", "set the number of edges to traverse in the hops queries").Default("3").IntVar(&qcfg.hops)
+}
+
+func testNames() []string {
+	names := make([]string, len(testCommands))
+	for i, tc := range testCommands {
+		names[i] = tc.name
+	}
+	return names
+}
+
+func findTest(name string) *testCommand {
+	for _, tc := range testCommands {
+		if tc.name == name {
+			return tc
+		}
+	}
 	return nil
 }
 
-// Creates graph with multiple fully connected subgraphs that are not connected
-// to one another
-func testConnectedSubgraphs(ctx context.Context, dgc *GraphConnection, nodeTypeCount, nodePredCount, predStringLength, rounds int) error {
-	quads := NewQuads()
-	for i := 0; i < nodeTypeCount; i++ {
-		subj := fmt.Sprintf("_:%d", i)
-		quads.SetQuadStr(subj, "dgraph.type", fmt.Sprintf("Node%d", i))
-		quads.SetQuadStr(subj, "name", fmt.Sprintf("Node%d", i))
-		for j := 0; j < nodePredCount; j++ {
-			quads.SetQuadStr(subj, fmt.Sprintf("pred%d", j), randomString(predStringLength))
+func main() {
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	if command == listCmd.FullCommand() {
+		for _, tc := range testCommands {
+			fmt.Printf("%-16s %s\n", tc.name, tc.help)
 		}
-		for k := 0; k < nodeTypeCount; k++ {
-			quads.SetQuadRel(subj, fmt.Sprintf("LINK%d", k), fmt.Sprintf("_:%d", k))
+		for _, cmd := range []*kingpin.CmdClause{queryCmd, mixedCmd, exportCmd, replayCmd, proxyCmd} {
+			fmt.Printf("%-16s %s\n", cmd.FullCommand(), cmd.Model().Help)
 		}
+		return
 	}
 
-	fmt.Printf("# Test Connnected Subgraphs: %d rounds; %d node types; %d predicates\n", rounds, nodeTypeCount, nodePredCount)
-	fmt.Println("round,time (ms)")
-	for r := 0; r < rounds; r++ {
-		startTime := time.Now()
-		err := dgc.Mutate(context.Background(), quads)
-		endTime := time.Now()
-		if err != nil {
-			return err
+	var err error
+	if sanitizer, err = NewSanitizer(*sanitizePolicy); err == nil {
+		if command == exportCmd.FullCommand() {
+			err = exportTest(findTest(*exportGraphName), exportTestCfg, runSeed(), *exportDir)
+		} else {
+			err = run(command)
 		}
-		fmt.Printf("%d,%d\n", r, endTime.Sub(startTime).Milliseconds())
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
 
-	return nil
+// session holds the state shared by the commands of a run.
+type session struct {
+	command  string
+	seed     int64
+	rate     float64 // open-loop rounds per second; 0 for a closed loop
+	profile  *loadProfile
+	rc       runContexts
+	results  *resultsFile
+	recorder *requestRecorder
 }
 
-// Creates graph with multiple fully connected subgraphs which are connected
-// to one another
-func testFullyConnected(ctx context.Context, dgc *GraphConnection, nodeTypeCount, nodePredCount, predStringLength, rounds int) error {
-	quads := NewQuads()
-	fmt.Printf("# Test Fully Connnected: %d rounds; %d node types; %d predicates of %d length\n", rounds, nodeTypeCount, nodePredCount, predStringLength)
-	fmt.Println("round,quad-count,time (ms)")
-	for r := 0; r < rounds; r++ {
-		for i := 0; i < nodeTypeCount; i++ {
-			nodeName := fmt.Sprintf("Node-%d.%d", r, i)
-			nodeType := fmt.Sprintf("Node%d", i)
-			upsertIDCurrent := quads.AddUpsertQuery("name", nodeName, nodeType)
-
-			quads.SetQuadStrUpsert(upsertIDCurrent, "dgraph.type", nodeType)
-			quads.SetQuadStrUpsert(upsertIDCurrent, "name", nodeName)
-			for j := 0; j < nodePredCount; j++ {
-				quads.SetQuadStrUpsert(upsertIDCurrent, fmt.Sprintf("pred%d", j), lessRandomString(predStringLength))
-			}
+// runSeed returns the seed of the run: the --seed flag, or a random seed.
+func runSeed() int64 {
+	if *seed != 0 {
+		return *seed
+	}
+	return time.Now().UnixNano()
+}
 
-			if i == 0 {
-				nodeNamePlus1 := fmt.Sprintf("Node-%d.%d", r+1, i)
-				upsertIDPlus1 := quads.AddUpsertQuery("name", nodeNamePlus1, nodeType)
-				quads.SetQuadStrUpsert(upsertIDPlus1, "dgraph.type", nodeType)
-				quads.SetQuadStrUpsert(upsertIDPlus1, "name", nodeNamePlus1)
-				quads.SetQuadRelUpsertFromTo(upsertIDCurrent, "NEXT", upsertIDPlus1)
-			}
+// openDgraphConn opens a connection to dgraph, recording its retries in the
+// results file, if any, and its mutations in the recording, if any.
+func (s *session) openDgraphConn() (*GraphConnection, error) {
+	dgc, err := openDgraphConn(s.rc.stop, *dgraphAddr)
+	if err != nil {
+		return nil, err
+	}
+	if s.recorder != nil {
+		dgc.RecordTo(s.recorder)
+	}
+	if s.results != nil {
+		dgc.OnRetry(func(op string, category ErrorCategory, attempt int, err error) {
+			s.results.Retry(retryRecord{Op: op, Category: string(category), Attempt: attempt, Error: err.Error()})
+		})
+	}
+	return dgc, nil
+}
+
+// initDgraphConn opens a connection to dgraph as openDgraphConn does, and
+// loads the schema of the test graph, so that its retries are recorded too.
+func (s *session) initDgraphConn(nodeTypeCount, nodePredCount int) (*GraphConnection, error) {
+	// Open connection
+	dgc, err := s.openDgraphConn()
+	if err != nil {
+		return nil, err
+	}
+
+	// Load schema
+	schema := buildSchema(nodeTypeCount, nodePredCount)
+	fmt.Printf("Schema:\n%s\n", schema)
+	err = dgc.LoadSchema(s.rc.stop, schema)
+	if err != nil {
+		return dgc, err
+	}
+	return dgc, nil
+}
+
+// newRunner returns a runner for the workload, recording its results in the
+// results file, if any.
+func (s *session) newRunner(wl Workload, cfg testConfig) *runner {
+	r := newRunner(wl, cfg)
+	r.seed = s.seed
+	if s.rate > 0 {
+		r.schedule = newArrivalSchedule(s.rate, *arrival, s.seed)
+	}
+	if s.profile != nil {
+		r.profile = s.profile
+		if r.schedule == nil && s.profile.firstRate() > 0 {
+			// The stages without a rate keep the rate of the previous ones.
+			r.schedule = newArrivalSchedule(s.profile.firstRate(), *arrival, s.seed)
+		}
+	}
+	if s.results != nil {
+		r.results = s.results
+		r.params = s.params(cfg)
+	}
+	return r
+}
+
+// runConfig returns cfg with the workers of the run, resolving the profile, if
+// any, for them. The workloads must be built with the returned cfg.
+func (s *session) runConfig(cfg testConfig) testConfig {
+	if s.profile != nil {
+		s.profile, cfg = s.profile.resolve(cfg)
+	}
+	return cfg
+}
 
-			for k := 0; k < nodeTypeCount; k++ {
-				upsertIDLink := quads.AddUpsertQuery("name", fmt.Sprintf("Node-%d.%d", r, k), fmt.Sprintf("Node%d", k))
-				quads.SetQuadRelUpsertFromTo(upsertIDCurrent, fmt.Sprintf("LINK%d", k), upsertIDLink)
+func (s *session) profileName() string {
+	if s.profile == nil {
+		return ""
+	}
+	return s.profile.name
+}
+
+func (s *session) params(cfg testConfig) []param {
+	return []param{
+		{Name: "command", Value: s.command},
+		{Name: "dgraph-addr", Value: strings.Join(*dgraphAddr, ",")},
+		{Name: "encoding", Value: *encoding},
+		{Name: "sanitize", Value: *sanitizePolicy},
+		{Name: "dry-run", Value: strconv.FormatBool(*dryRun)},
+		{Name: "node-type-count", Value: strconv.Itoa(cfg.nodeTypeCount)},
+		{Name: "node-pred-count", Value: strconv.Itoa(cfg.nodePredCount)},
+		{Name: "pred-string-len", Value: strconv.Itoa(cfg.predStringLen)},
+		{Name: "rounds", Value: strconv.Itoa(cfg.rounds)},
+		{Name: "seed", Value: strconv.FormatInt(s.seed, 10)},
+		{Name: "rate", Value: *rateSpec},
+		{Name: "arrival", Value: *arrival},
+		{Name: "profile", Value: s.profileName()},
+		{Name: "workers", Value: strconv.Itoa(cfg.workers)},
+		{Name: "edges-per-node", Value: strconv.Itoa(cfg.edgesPerNode)},
+		{Name: "mean-degree", Value: strconv.FormatFloat(cfg.meanDegree, 'g', -1, 64)},
+		{Name: "edge-probability", Value: strconv.FormatFloat(cfg.edgeProbability, 'g', -1, 64)},
+		{Name: "degree-distribution", Value: cfg.degrees.String()},
+		{Name: "duration", Value: duration.String()},
+		{Name: "start-time", Value: time.Now().UTC().Format(time.RFC3339)},
+	}
+}
+
+func run(command string) (err error) {
+	if *dryRun {
+		fmt.Printf("# dry run; emit-dir: %s\n", *emitDir)
+	} else {
+		fmt.Printf("# dgraph-addr(s): %v\n", *dgraphAddr)
+	}
+
+	if *metricsAddr != "" {
+		if err := serveMetrics(*metricsAddr); err != nil {
+			return err
+		}
+		fmt.Printf("# metrics-addr: %s\n", *metricsAddr)
+	}
+
+	rc, release := newRunContexts(*duration, *gracePeriod)
+	defer release()
+	s := &session{command: command, seed: runSeed(), rc: rc}
+	for _, tc := range testCommands {
+		tc.cfg.seed = s.seed
+	}
+	queryTest.seed = s.seed
+	mixedTest.seed = s.seed
+	if *rateSpec != "" {
+		if s.rate, err = parseRate(*rateSpec); err != nil {
+			return err
+		}
+	}
+	if s.profile, err = buildProfile(*profileOpts); err != nil {
+		return err
+	}
+
+	if *outputPath != "" {
+		s.results, err = createResultsFile(*outputPath, *outputFormat)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := s.results.Close(); err == nil {
+				err = closeErr
 			}
+		}()
+		fmt.Printf("# output: %s (%s)\n", *outputPath, *outputFormat)
+	}
+
+	switch command {
+	case queryCmd.FullCommand(), mixedCmd.FullCommand(), replayCmd.FullCommand(), proxyCmd.FullCommand():
+		if *dryRun {
+			return fmt.Errorf("--dry-run is only supported by the test commands")
 		}
+	}
+	if *recordPath != "" {
+		if *dryRun || command == proxyCmd.FullCommand() {
+			return fmt.Errorf("--record is not supported by dry runs and the proxy")
+		}
+		s.recorder, err = createRecorder(*recordPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := s.recorder.Close(); err == nil {
+				err = closeErr
+			}
+			fmt.Printf("# record: %d requests to %s\n", s.recorder.Count(), *recordPath)
+		}()
+	}
 
-		fmt.Printf("%s\n\n\n\n", quads.String())
+	switch command {
+	case queryCmd.FullCommand():
+		return runQuery(s)
+	case mixedCmd.FullCommand():
+		return runMixed(s)
+	case replayCmd.FullCommand():
+		return runReplay(s)
+	case proxyCmd.FullCommand():
+		return runProxy(s)
+	default:
+		return runTest(s, findTest(command))
+	}
+}
 
-		startTime := time.Now()
-		err := dgc.Mutate(context.Background(), quads)
-		endTime := time.Now()
+func runTest(s *session, tc *testCommand) error {
+	if err := tc.checkConfig(tc.cfg); err != nil {
+		return err
+	}
+	cfg := s.runConfig(tc.cfg)
+	if *dryRun {
+		schema := buildSchema(cfg.nodeTypeCount, cfg.nodePredCount)
+		wl, err := newEmitWorkload(tc.newGenerator(cfg), schema, *emitDir, *encoding)
 		if err != nil {
 			return err
 		}
-		fmt.Printf("%d,%d,%d\n", r, quads.Size(), endTime.Sub(startTime).Milliseconds())
-		quads.Clear()
+		return s.newRunner(wl, cfg).Run(s.rc)
 	}
 
-	return nil
+	dgc, err := s.initDgraphConn(cfg.nodeTypeCount, cfg.nodePredCount)
+	if err != nil {
+		return err
+	}
+	defer dgc.Close()
+
+	return s.newRunner(newWriteWorkload(dgc, tc.newGenerator(cfg)), cfg).Run(s.rc)
 }
 
-var (
-	app           = kingpin.New("dgraph-stress-test", "create a synthetic graph")
-	dgraphAddr    = app.Flag("dgraph-addr", "set the connection string (host:port) for Dgraph DB; use multiple flags for multiple servers").Default("127.0.0.1:9080").Strings()
-	nodeTypeCount = app.Flag("node-type-count", "set the number of node types").Default("50").Int()
-	nodePredCount = app.Flag("node-pred-count", "set the number of predicates per node").Default("50").Int()
-	predStringLen = app.Flag("pred-string-len", "set the length of the string to store in each predicate").Default("20").Int()
-	rounds        = app.Flag("rounds", "set the number of rounds to perform").Default("500000").Int()
-)
+func runQuery(s *session) error {
+	dgc, err := s.openDgraphConn()
+	if err != nil {
+		return err
+	}
+	defer dgc.Close()
 
-func main() {
-	_, err := app.Parse(os.Args[1:])
+	cfg := s.runConfig(queryTest)
+	// The generator names the nodes of the graph queried, which was created
+	// by the graph rounds and workers rather than those of the queries.
+	graphCfg := cfg
+	graphCfg.rounds, graphCfg.workers = queryOpts.graphRounds, queryOpts.graphWorkers
+	gen := findTest(queryOpts.graph).newGenerator(graphCfg)
+	wl, err := newQueryWorkload(dgc, gen, cfg, queryOpts)
+	if err != nil {
+		return err
+	}
+	return s.newRunner(wl, cfg).Run(s.rc)
+}
+
+func runMixed(s *session) error {
+	mix, err := parseMix(*mixSpec)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	fmt.Printf("# dgraph-addr(s): %v\n", *dgraphAddr)
 
-	dgc, err := initDgraphConn(context.Background(), *dgraphAddr, *nodeTypeCount, *nodePredCount)
+	if err := findTest(mixedOpts.graph).checkConfig(mixedTest); err != nil {
+		return err
+	}
+	cfg := s.runConfig(mixedTest)
+	dgc, err := s.initDgraphConn(cfg.nodeTypeCount, cfg.nodePredCount)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer dgc.Close()
 
-	err = testFullyConnected(context.Background(), dgc, *nodeTypeCount, *nodePredCount, *predStringLen, *rounds)
+	gen := findTest(mixedOpts.graph).newGenerator(cfg)
+	qwl, err := newQueryWorkload(dgc, gen, cfg, mixedOpts)
+	if err != nil {
+		return err
+	}
+	r := s.newRunner(newMixedWorkload(dgc, newWriteWorkload(dgc, gen), qwl, mix), cfg)
+	r.tolerateErrors = true
+	return r.Run(s.rc)
+}
+
+func runReplay(s *session) error {
+	recs, err := readRecording(*replayFile)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	if len(recs) == 0 {
+		return fmt.Errorf("no requests to replay in %s", *replayFile)
+	}
+
+	dgc, err := s.openDgraphConn()
+	if err != nil {
+		return err
+	}
+	defer dgc.Close()
 
+	cfg := s.runConfig(testConfig{rounds: len(recs), workers: *replayWorkers})
+	wl := newReplayWorkload(dgc, *replayFile, recs, *replaySpeed, cfg.workers)
+	return s.newRunner(wl, cfg).Run(s.rc)
+}
+
+func runProxy(s *session) error {
+	opts, err := connOptions()
+	if err != nil {
+		return err
+	}
+	connectCtx, connectCancel := context.WithTimeout(s.rc.stop, dgraphTimeout)
+	defer connectCancel()
+	conn, err := dialUpstream(connectCtx, (*dgraphAddr)[0], opts)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ln, err := net.Listen("tcp", *proxyListen)
+	if err != nil {
+		return fmt.Errorf("unable to listen for proxy on %s: %s", *proxyListen, err)
+	}
+	fmt.Printf("# proxy: %s to %s; %s\n", *proxyListen, (*dgraphAddr)[0], proxyFaults)
+	return newFaultProxy(dgoapi.NewDgraphClient(conn), proxyFaults).Serve(s.rc.stop, ln)
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "dgraph_stress"
+
+var (
+	mutationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "mutations_total",
+		Help:      "Number of dgraph mutations performed, by status.",
+	}, []string{"status"})
+	mutationDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "mutation_duration_seconds",
+		Help:      "Time taken by dgraph mutations, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 18),
+	})
+	quadsSentTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "quads_sent_total",
+		Help:      "Number of quads sent in successful mutations.",
+	})
+	queriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "queries_total",
+		Help:      "Number of dgraph queries performed, by status.",
+	}, []string{"status"})
+	queryDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_duration_seconds",
+		Help:      "Time taken by dgraph queries, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 18),
+	})
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retries_total",
+		Help:      "Number of retried dgraph operations, by operation and error category.",
+	}, []string{"op", "category"})
+	errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "errors_total",
+		Help:      "Number of failed dgraph operations, by operation and error category.",
+	}, []string{"op", "category"})
+	reconnectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconnects_total",
+		Help:      "Number of dgraph reconnects, by status.",
+	}, []string{"status"})
+	loginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "logins_total",
+		Help:      "Number of dgraph ACL logins, by status.",
+	}, []string{"status"})
+	schemaAltersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "schema_alters_total",
+		Help:      "Number of dgraph schema alters performed, by status.",
+	}, []string{"status"})
+	schemaAlterDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "schema_alter_duration_seconds",
+		Help:      "Time taken by dgraph schema alters, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	})
+	scheduleMissesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "schedule_misses_total",
+		Help:      "Number of open-loop rounds started after their scheduled time.",
+	})
+	proxyFaultsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "proxy_faults_total",
+		Help:      "Number of faults injected by the proxy, by fault.",
+	}, []string{"fault"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		mutationsTotal,
+		mutationDuration,
+		quadsSentTotal,
+		queriesTotal,
+		queryDuration,
+		retriesTotal,
+		errorsTotal,
+		reconnectsTotal,
+		loginsTotal,
+		schemaAltersTotal,
+		schemaAlterDuration,
+		scheduleMissesTotal,
+		proxyFaultsTotal,
+	)
+}
+
+// statusLabel returns the status label value for the outcome of an operation.
+func statusLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// serveMetrics starts an HTTP server publishing the Prometheus metrics on
+// addr at /metrics.
+func serveMetrics(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen for metrics on %s: %s", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go http.Serve(ln, mux)
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operations of the mixed workload.
+const (
+	mixWrite  = "write"
+	mixQuery  = "query"
+	mixDelete = "delete"
+)
+
+type mixEntry struct {
+	op     string
+	weight int
+}
+
+// parseMix parses a comma separated list of op=weight pairs.
+func parseMix(spec string) ([]mixEntry, error) {
+	var mix []mixEntry
+	total := 0
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid mix entry %q: must be op=weight", part)
+		}
+		op := strings.TrimSpace(kv[0])
+		if op != mixWrite && op != mixQuery && op != mixDelete {
+			return nil, fmt.Errorf("invalid mix entry %q: op must be one of %s, %s, %s", part, mixWrite, mixQuery, mixDelete)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid mix entry %q: weight must be a non-negative integer", part)
+		}
+		mix = append(mix, mixEntry{op: op, weight: weight})
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("invalid mix %q: the weights must not all be zero", spec)
+	}
+	return mix, nil
+}
+
+// mixedWorkload picks the operation of each round by weight: writing the
+// next round of a generator, querying the graph, or deleting one of its
+// nodes.
+type mixedWorkload struct {
+	dgc   *GraphConnection
+	write *writeWorkload
+	query *queryWorkload
+	mix   []mixEntry
+	total int
+}
+
+func newMixedWorkload(dgc *GraphConnection, write *writeWorkload, query *queryWorkload, mix []mixEntry) *mixedWorkload {
+	total := 0
+	for _, m := range mix {
+		total += m.weight
+	}
+	return &mixedWorkload{dgc: dgc, write: write, query: query, mix: mix, total: total}
+}
+
+func (wl *mixedWorkload) Header() string {
+	parts := make([]string, len(wl.mix))
+	for i, m := range wl.mix {
+		parts[i] = fmt.Sprintf("%s=%d", m.op, m.weight)
+	}
+	return fmt.Sprintf("Test Mixed: %s; %s", strings.Join(parts, ","), wl.query.Header())
+}
+
+func (wl *mixedWorkload) pick(rng *rand.Rand) string {
+	n := rng.Intn(wl.total)
+	for _, m := range wl.mix {
+		if n < m.weight {
+			return m.op
+		}
+		n -= m.weight
+	}
+	return wl.mix[len(wl.mix)-1].op
+}
+
+func (wl *mixedWorkload) Do(ctx context.Context, w *worker, round int) opResult {
+	switch wl.pick(w.rng) {
+	case mixWrite:
+		return wl.write.Do(ctx, w, round)
+	case mixQuery:
+		return wl.query.Do(ctx, w, round)
+	default:
+		return wl.delete(ctx, w)
+	}
+}
+
+// delete removes a random node of the graph with an upsert.
+func (wl *mixedWorkload) delete(ctx context.Context, w *worker) opResult {
+	name, nodeType := wl.query.randomNode(w.rng)
+	quads := NewQuads()
+	quads.DelQuadNodeUpsert(quads.AddUpsertQuery("name", name, nodeType))
+
+	startTime := time.Now()
+	err := wl.dgc.Mutate(ctx, quads)
+	endTime := time.Now()
+	return opResult{op: mixDelete, quads: quads, latency: endTime.Sub(startTime), err: err}
+}
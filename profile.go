@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+)
+
+// Shapes of the load profiles.
+const (
+	profileRamp     = "ramp"
+	profileStep     = "step"
+	profileSpike    = "spike"
+	profileSawtooth = "sawtooth"
+)
+
+// Loads varied by the profiles.
+const (
+	profileByWorkers = "workers"
+	profileByRate    = "rate"
+)
+
+// profileConfig sets the load profile of a run, either from a shape or from a
+// file.
+type profileConfig struct {
+	shape         string
+	file          string
+	by            string
+	from          float64
+	to            float64
+	step          float64
+	steps         int
+	stageDuration time.Duration
+	cycles        int
+}
+
+// newProfileConfig returns the profile config set by the flags it registers on
+// app.
+func newProfileConfig(app *kingpin.Application) *profileConfig {
+	c := &profileConfig{}
+	c.registerFlags(app)
+	return c
+}
+
+func (c *profileConfig) registerFlags(app *kingpin.Application) {
+	app.Flag("profile", "vary the load in stages of this shape ("+strings.Join([]string{profileRamp, profileStep, profileSpike, profileSawtooth}, ", ")+"); constant load if empty").EnumVar(&c.shape, "", profileRamp, profileStep, profileSpike, profileSawtooth)
+	app.Flag("profile-file", "read the load stages from this file, one \"duration [workers=N] [rate=N/s]\" stage per line").StringVar(&c.file)
+	app.Flag("profile-by", "set the load varied by the profile (workers, rate)").Default(profileByWorkers).EnumVar(&c.by, profileByWorkers, profileByRate)
+	app.Flag("profile-from", "set the load of the first stage of the profile, in workers or rounds/s").Default("1").Float64Var(&c.from)
+	app.Flag("profile-to", "set the peak load of the profile, in workers or rounds/s").Default("10").Float64Var(&c.to)
+	app.Flag("profile-step", "set the load added at each stage of the step profile").Default("1").Float64Var(&c.step)
+	app.Flag("profile-steps", "set the number of stages of the ramp and sawtooth profiles").Default("10").IntVar(&c.steps)
+	app.Flag("profile-stage-duration", "set the duration of each stage of the profile").Default("30s").DurationVar(&c.stageDuration)
+	app.Flag("profile-cycles", "set the number of ramps of the sawtooth profile").Default("3").IntVar(&c.cycles)
+}
+
+// loadStage is a stage of a load profile. A zero workers or rate keeps the
+// run's setting.
+type loadStage struct {
+	duration time.Duration
+	workers  int
+	rate     float64 // rounds per second
+}
+
+func (s loadStage) String() string {
+	desc := s.duration.String()
+	if s.workers > 0 {
+		desc += fmt.Sprintf("; %d workers", s.workers)
+	}
+	if s.rate > 0 {
+		desc += fmt.Sprintf("; %g rounds/s", s.rate)
+	}
+	return desc
+}
+
+// loadProfile is the sequence of stages of the load of a run.
+type loadProfile struct {
+	name   string
+	stages []loadStage
+}
+
+// Duration returns the total duration of the stages.
+func (p *loadProfile) Duration() time.Duration {
+	var d time.Duration
+	for _, s := range p.stages {
+		d += s.duration
+	}
+	return d
+}
+
+// withWorkers returns a copy of the profile where the stages keeping the run's
+// workers have the given workers.
+func (p *loadProfile) withWorkers(workers int) *loadProfile {
+	wp := &loadProfile{name: p.name, stages: append([]loadStage(nil), p.stages...)}
+	for i := range wp.stages {
+		if wp.stages[i].workers == 0 {
+			wp.stages[i].workers = workers
+		}
+	}
+	return wp
+}
+
+// maxWorkers returns the most workers of a stage.
+func (p *loadProfile) maxWorkers() int {
+	max := 0
+	for _, s := range p.stages {
+		if s.workers > max {
+			max = s.workers
+		}
+	}
+	return max
+}
+
+// resolve returns the profile with the stages keeping the run's workers set to
+// the workers of cfg, and cfg with enough workers for the busiest stage. The
+// workloads indexed by worker must be built with the returned cfg.
+func (p *loadProfile) resolve(cfg testConfig) (*loadProfile, testConfig) {
+	if cfg.workers < 1 {
+		cfg.workers = 1
+	}
+	rp := p.withWorkers(cfg.workers)
+	cfg.workers = rp.maxWorkers()
+	return rp, cfg
+}
+
+// firstRate returns the rate of the first stage setting one, or 0.
+func (p *loadProfile) firstRate() float64 {
+	for _, s := range p.stages {
+		if s.rate > 0 {
+			return s.rate
+		}
+	}
+	return 0
+}
+
+// buildProfile returns the load profile set by cfg, or nil if none is set.
+func buildProfile(cfg profileConfig) (*loadProfile, error) {
+	if cfg.file != "" {
+		if cfg.shape != "" {
+			return nil, fmt.Errorf("--profile and --profile-file are mutually exclusive")
+		}
+		f, err := os.Open(cfg.file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open profile file: %s", err)
+		}
+		defer f.Close()
+		stages, err := parseProfile(f)
+		if err != nil {
+			return nil, err
+		}
+		return &loadProfile{name: cfg.file, stages: stages}, nil
+	}
+	if cfg.shape == "" {
+		return nil, nil
+	}
+
+	if cfg.stageDuration <= 0 {
+		return nil, fmt.Errorf("the profile stage duration must be positive")
+	}
+	if cfg.from <= 0 || cfg.to <= 0 {
+		return nil, fmt.Errorf("the profile loads must be positive")
+	}
+	var levels []float64
+	switch cfg.shape {
+	case profileRamp:
+		levels = rampLevels(cfg.from, cfg.to, cfg.steps)
+	case profileStep:
+		if cfg.step <= 0 || cfg.to < cfg.from {
+			return nil, fmt.Errorf("the step profile needs a positive step and a peak load above the first")
+		}
+		for l := cfg.from; l <= cfg.to+1e-9; l += cfg.step {
+			levels = append(levels, l)
+		}
+	case profileSpike:
+		levels = []float64{cfg.from, cfg.to, cfg.from}
+	case profileSawtooth:
+		for i := 0; i < cfg.cycles; i++ {
+			levels = append(levels, rampLevels(cfg.from, cfg.to, cfg.steps)...)
+		}
+	}
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("the %s profile has no stages", cfg.shape)
+	}
+
+	p := &loadProfile{name: fmt.Sprintf("%s of %s from %g to %g", cfg.shape, cfg.by, cfg.from, cfg.to)}
+	for _, l := range levels {
+		s := loadStage{duration: cfg.stageDuration}
+		if cfg.by == profileByRate {
+			s.rate = l
+		} else {
+			s.workers = int(math.Round(l))
+		}
+		p.stages = append(p.stages, s)
+	}
+	return p, nil
+}
+
+// rampLevels returns the loads of steps stages rising linearly from one load
+// to another.
+func rampLevels(from, to float64, steps int) []float64 {
+	if steps <= 1 {
+		return []float64{to}
+	}
+	levels := make([]float64, steps)
+	for i := range levels {
+		levels[i] = from + (to-from)*float64(i)/float64(steps-1)
+	}
+	return levels
+}
+
+// parseProfile parses the stages of a profile file, one per line: a duration
+// followed by optional workers=N and rate=N/unit settings. Blank lines and
+// "#" comment lines are skipped.
+func parseProfile(r io.Reader) ([]loadStage, error) {
+	var stages []loadStage
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		d, err := time.ParseDuration(fields[0])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid profile line %d: %q is not a positive duration", line, fields[0])
+		}
+		s := loadStage{duration: d}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid profile line %d: %q must be key=value", line, field)
+			}
+			switch kv[0] {
+			case "workers":
+				if s.workers, err = strconv.Atoi(kv[1]); err != nil || s.workers < 1 {
+					return nil, fmt.Errorf("invalid profile line %d: workers must be a positive integer", line)
+				}
+			case "rate":
+				if s.rate, err = parseRate(kv[1]); err != nil {
+					return nil, fmt.Errorf("invalid profile line %d: %s", line, err)
+				}
+			default:
+				return nil, fmt.Errorf("invalid profile line %d: unknown setting %q", line, kv[0])
+			}
+		}
+		stages = append(stages, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read profile file: %s", err)
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("the profile file has no stages")
+	}
+	return stages, nil
+}
+
+// stageStats accumulates the results of the rounds started in a stage.
+type stageStats struct {
+	stage  loadStage
+	start  time.Time
+	end    time.Time
+	rounds int64
+	quads  int64
+	stats  map[string]*opStats
+}
+
+// startProfile sets up the first stage of the profile and starts moving
+// through the others until stop is done, calling done when the last one
+// ends. The returned channel is closed once it stopped moving.
+func (r *runner) startProfile(stop context.Context, startTime time.Time, done func()) <-chan struct{} {
+	r.setStage(0, startTime)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer done()
+		next := startTime
+		for i, s := range r.profile.stages {
+			next = next.Add(s.duration)
+			if sleepContext(stop, time.Until(next)) != nil {
+				return
+			}
+			if i+1 < len(r.profile.stages) {
+				r.setStage(i+1, next)
+			}
+		}
+	}()
+	return finished
+}
+
+// endStages sets the end of the last stage reached to the end of the run.
+func (r *runner) endStages(endTime time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.stages); n > 0 {
+		r.stages[n-1].end = endTime
+	}
+}
+
+// setStage moves the run to stage i, started at t, and wakes the workers
+// waiting for it.
+func (r *runner) setStage(i int, t time.Time) {
+	s := r.profile.stages[i]
+	if s.rate > 0 && r.schedule != nil {
+		r.schedule.SetRate(s.rate)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i > 0 {
+		r.stages[i-1].end = t
+	}
+	r.stages = append(r.stages, &stageStats{stage: s, start: t, stats: make(map[string]*opStats)})
+	r.active = s.workers
+	if r.stageChanged != nil {
+		close(r.stageChanged)
+	}
+	r.stageChanged = make(chan struct{})
+	fmt.Printf("# Stage %d: %s\n", i, s)
+}
+
+// waitActive waits until the worker is active in the current stage, and
+// returns false if stop or ctx are done first.
+func (r *runner) waitActive(stop, ctx context.Context, id int) bool {
+	for {
+		r.mu.Lock()
+		active, changed := r.active, r.stageChanged
+		r.mu.Unlock()
+		if id < active {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-stop.Done():
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// currentStage returns the index of the current stage, or -1 without a
+// profile.
+func (r *runner) currentStage() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.stages) - 1
+}
+
+// stageSummaries returns the summaries of the stages reached. The run must be
+// over.
+func (r *runner) stageSummaries() []stageSummary {
+	var sums []stageSummary
+	for i, st := range r.stages {
+		end := st.end
+		sum := stageSummary{
+			Stage:     i,
+			Workers:   st.stage.workers,
+			Rate:      st.stage.rate,
+			Rounds:    st.rounds,
+			Quads:     st.quads,
+			ElapsedMs: durationMs(end.Sub(st.start)),
+		}
+		if secs := end.Sub(st.start).Seconds(); secs > 0 {
+			sum.RoundsPerSec = float64(st.rounds) / secs
+			sum.QuadsPerSec = float64(st.quads) / secs
+		}
+		for _, op := range sortedOps(st.stats) {
+			sum.Ops = append(sum.Ops, newOpSummary(op, st.stats[op]))
+		}
+		sums = append(sums, sum)
+	}
+	return sums
+}
+
+// writeStageSummaries writes the results of every stage reached.
+func (r *runner) writeStageSummaries() {
+	for i, sum := range r.stageSummaries() {
+		st := r.stages[i]
+		fmt.Printf("# Stage %d (%s): %d rounds; %d quads; %.1f rounds/s; %.1f quads/s\n",
+			i, st.stage, sum.Rounds, sum.Quads, sum.RoundsPerSec, sum.QuadsPerSec)
+		for _, op := range sortedOps(st.stats) {
+			st.stats[op].latency.WriteLatency(os.Stdout, fmt.Sprintf("stage %d %s", i, op))
+		}
+	}
+}
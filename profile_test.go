@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildProfile(t *testing.T) {
+	base := profileConfig{by: profileByWorkers, from: 1, to: 4, step: 1, steps: 4, stageDuration: time.Second, cycles: 2}
+	tests := []struct {
+		shape   string
+		by      string
+		workers []int
+		rates   []float64
+	}{
+		{shape: profileRamp, workers: []int{1, 2, 3, 4}},
+		{shape: profileStep, workers: []int{1, 2, 3, 4}},
+		{shape: profileSpike, workers: []int{1, 4, 1}},
+		{shape: profileSawtooth, workers: []int{1, 2, 3, 4, 1, 2, 3, 4}},
+		{shape: profileSpike, by: profileByRate, rates: []float64{1, 4, 1}},
+	}
+	for _, tt := range tests {
+		cfg := base
+		cfg.shape = tt.shape
+		if tt.by != "" {
+			cfg.by = tt.by
+		}
+		p, err := buildProfile(cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.shape, err)
+		}
+		if n := len(tt.workers) + len(tt.rates); len(p.stages) != n {
+			t.Fatalf("%s: expected %d stages, got %v", tt.shape, n, p.stages)
+		}
+		for i, s := range p.stages {
+			if s.duration != time.Second {
+				t.Errorf("%s: expected stages of 1s, got %s", tt.shape, s.duration)
+			}
+			if tt.workers != nil && (s.workers != tt.workers[i] || s.rate != 0) {
+				t.Errorf("%s: stage %d: expected %d workers, got %s", tt.shape, i, tt.workers[i], s)
+			}
+			if tt.rates != nil && (s.rate != tt.rates[i] || s.workers != 0) {
+				t.Errorf("%s: stage %d: expected %g rounds/s, got %s", tt.shape, i, tt.rates[i], s)
+			}
+		}
+	}
+
+	if p, err := buildProfile(profileConfig{}); p != nil || err != nil {
+		t.Errorf("expected no profile, got %v, %v", p, err)
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	stages, err := parseProfile(strings.NewReader("# warm up\n10s workers=2\n\n1m rate=100/s\n30s workers=4 rate=50\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []loadStage{
+		{duration: 10 * time.Second, workers: 2},
+		{duration: time.Minute, rate: 100},
+		{duration: 30 * time.Second, workers: 4, rate: 50},
+	}
+	if len(stages) != len(want) {
+		t.Fatalf("expected %v, got %v", want, stages)
+	}
+	for i := range want {
+		if stages[i] != want[i] {
+			t.Errorf("stage %d: expected %s, got %s", i, want[i], stages[i])
+		}
+	}
+
+	for _, spec := range []string{"", "fast workers=2", "10s workers=0", "10s rate=x", "10s speed=2", "10s 2"} {
+		if _, err := parseProfile(strings.NewReader(spec)); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestRunnerProfile(t *testing.T) {
+	r := newRunner(sleepWorkload(5*time.Millisecond), testConfig{workers: 1})
+	r.profile = &loadProfile{name: "test", stages: []loadStage{
+		{duration: 100 * time.Millisecond},
+		{duration: 100 * time.Millisecond, workers: 4},
+	}}
+	rc := runContexts{stop: context.Background(), ops: context.Background()}
+	startTime := time.Now()
+	if err := r.Run(rc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if elapsed := time.Since(startTime); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected the run to stop at the end of the profile, took %s", elapsed)
+	}
+	if r.workers != 4 {
+		t.Errorf("expected 4 workers, got %d", r.workers)
+	}
+
+	sums := r.stageSummaries()
+	if len(sums) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(sums))
+	}
+	if sums[0].Workers != 1 || sums[1].Workers != 4 {
+		t.Errorf("expected 1 then 4 workers, got %d then %d", sums[0].Workers, sums[1].Workers)
+	}
+	if sums[1].Rounds < 2*sums[0].Rounds {
+		t.Errorf("expected more rounds with more workers, got %d then %d", sums[0].Rounds, sums[1].Rounds)
+	}
+	if total := sums[0].Rounds + sums[1].Rounds; total != r.totalRounds {
+		t.Errorf("expected the stages to add up to %d rounds, got %d", r.totalRounds, total)
+	}
+}
+
+func TestRunnerProfileReplay(t *testing.T) {
+	fs := startFakeServer(t)
+	gc := fs.connect(t, fs.connOptions())
+	var recs []requestRecord
+	for i := 0; i < 6; i++ {
+		recs = append(recs, requestRecord{Set: fmt.Sprintf("_:n <name> \"%d\" .\n", i)})
+	}
+
+	p := &loadProfile{name: "test", stages: []loadStage{
+		{duration: 50 * time.Millisecond},
+		{duration: 50 * time.Millisecond, workers: 3},
+	}}
+	p, cfg := p.resolve(testConfig{rounds: len(recs), workers: 1})
+	if cfg.workers != 3 {
+		t.Fatalf("expected 3 workers, got %d", cfg.workers)
+	}
+	r := newRunner(newReplayWorkload(gc, "test", recs, 0, cfg.workers), cfg)
+	r.profile = p
+	rc := runContexts{stop: context.Background(), ops: context.Background()}
+	if err := r.Run(rc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	replayed := make(map[string]int)
+	for _, req := range fs.Requests() {
+		replayed[string(req.Mutations[0].SetNquads)]++
+	}
+	for _, rec := range recs {
+		if replayed[rec.Set] != 1 {
+			t.Errorf("expected request %q to be replayed once, got %d", rec.Set, replayed[rec.Set])
+		}
+	}
+}
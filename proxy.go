@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// faultConfig sets the faults injected by the proxy.
+type faultConfig struct {
+	latency        time.Duration
+	latencyJitter  time.Duration
+	abortRate      float64
+	resetEvery     time.Duration
+	blackholeEvery time.Duration
+	blackholeFor   time.Duration
+}
+
+func (c *faultConfig) registerFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("latency", "add this latency to every request").Default("0").DurationVar(&c.latency)
+	cmd.Flag("latency-jitter", "add up to this random latency to every request").Default("0").DurationVar(&c.latencyJitter)
+	cmd.Flag("abort-rate", "set the probability (0 to 1) of aborting a mutation or commit").Default("0").Float64Var(&c.abortRate)
+	cmd.Flag("reset-every", "reset all client connections at this interval; 0 to disable").Default("0").DurationVar(&c.resetEvery)
+	cmd.Flag("blackhole-every", "stop answering requests at this interval; 0 to disable").Default("0").DurationVar(&c.blackholeEvery)
+	cmd.Flag("blackhole-for", "set how long requests are left unanswered by each blackhole").Default("10s").DurationVar(&c.blackholeFor)
+}
+
+func (c faultConfig) String() string {
+	return fmt.Sprintf("latency %s (+%s jitter); abort rate %g; reset every %s; blackhole every %s for %s",
+		c.latency, c.latencyJitter, c.abortRate, c.resetEvery, c.blackholeEvery, c.blackholeFor)
+}
+
+// faultProxy is a dgraph gRPC proxy that forwards requests to an alpha and
+// injects faults between the clients and the alpha.
+type faultProxy struct {
+	upstream dgoapi.DgraphClient
+	cfg      faultConfig
+	conns    *trackingListener
+
+	mu             sync.Mutex // guards rng and blackholeUntil
+	rng            *rand.Rand
+	blackholeUntil time.Time
+}
+
+func newFaultProxy(upstream dgoapi.DgraphClient, cfg faultConfig) *faultProxy {
+	return &faultProxy{
+		upstream: upstream,
+		cfg:      cfg,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Serve accepts client connections on ln until ctx is done, injecting the
+// scheduled faults meanwhile.
+func (p *faultProxy) Serve(ctx context.Context, ln net.Listener) error {
+	p.conns = newTrackingListener(ln)
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxRecvMsgSize),
+		grpc.MaxSendMsgSize(maxSendMsgSize),
+	)
+	dgoapi.RegisterDgraphServer(srv, p)
+
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+	go p.schedule(ctx, p.cfg.resetEvery, func() {
+		fmt.Printf("# proxy: reset %d connections\n", p.resetConnections())
+	})
+	go p.schedule(ctx, p.cfg.blackholeEvery, func() {
+		fmt.Printf("# proxy: blackhole for %s\n", p.cfg.blackholeFor)
+		p.blackhole(p.cfg.blackholeFor)
+	})
+
+	if err := srv.Serve(p.conns); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("unable to serve proxy: %s", err)
+	}
+	return nil
+}
+
+// schedule calls fn at every interval until ctx is done.
+func (p *faultProxy) schedule(ctx context.Context, interval time.Duration, fn func()) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
+
+// resetConnections resets the client connections and returns their number.
+func (p *faultProxy) resetConnections() int {
+	n := p.conns.resetAll()
+	proxyFaultsTotal.WithLabelValues("reset").Add(float64(n))
+	return n
+}
+
+// blackhole leaves the requests unanswered for d.
+func (p *faultProxy) blackhole(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blackholeUntil = time.Now().Add(d)
+}
+
+func (p *faultProxy) chance(rate float64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return rate > 0 && p.rng.Float64() < rate
+}
+
+func (p *faultProxy) jitter() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cfg.latencyJitter <= 0 {
+		return 0
+	}
+	return time.Duration(p.rng.Int63n(int64(p.cfg.latencyJitter)))
+}
+
+// inject delays a request by the blackhole and latency and returns the error
+// to answer it with instead of forwarding it, if any. Only requests that
+// write to a transaction may be aborted.
+func (p *faultProxy) inject(ctx context.Context, write bool) error {
+	p.mu.Lock()
+	blackhole := time.Until(p.blackholeUntil)
+	p.mu.Unlock()
+	if blackhole > 0 {
+		proxyFaultsTotal.WithLabelValues("blackhole").Inc()
+		if err := sleepContext(ctx, blackhole); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+
+	if latency := p.cfg.latency + p.jitter(); latency > 0 {
+		proxyFaultsTotal.WithLabelValues("latency").Inc()
+		if err := sleepContext(ctx, latency); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+
+	if write && p.chance(p.cfg.abortRate) {
+		proxyFaultsTotal.WithLabelValues("abort").Inc()
+		return status.Error(codes.Aborted, "Transaction has been aborted. Please retry")
+	}
+	return nil
+}
+
+// forwardContext passes the metadata of a client request, such as the ACL
+// access token, on to the upstream request.
+func forwardContext(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		return metadata.NewOutgoingContext(ctx, md.Copy())
+	}
+	return ctx
+}
+
+func (p *faultProxy) Login(ctx context.Context, req *dgoapi.LoginRequest) (*dgoapi.Response, error) {
+	if err := p.inject(ctx, false); err != nil {
+		return nil, err
+	}
+	return p.upstream.Login(forwardContext(ctx), req)
+}
+
+func (p *faultProxy) Query(ctx context.Context, req *dgoapi.Request) (*dgoapi.Response, error) {
+	if err := p.inject(ctx, len(req.Mutations) > 0); err != nil {
+		return nil, err
+	}
+	return p.upstream.Query(forwardContext(ctx), req)
+}
+
+func (p *faultProxy) Alter(ctx context.Context, op *dgoapi.Operation) (*dgoapi.Payload, error) {
+	if err := p.inject(ctx, false); err != nil {
+		return nil, err
+	}
+	return p.upstream.Alter(forwardContext(ctx), op)
+}
+
+func (p *faultProxy) CommitOrAbort(ctx context.Context, txn *dgoapi.TxnContext) (*dgoapi.TxnContext, error) {
+	if err := p.inject(ctx, !txn.Aborted); err != nil {
+		return nil, err
+	}
+	return p.upstream.CommitOrAbort(forwardContext(ctx), txn)
+}
+
+func (p *faultProxy) CheckVersion(ctx context.Context, c *dgoapi.Check) (*dgoapi.Version, error) {
+	if err := p.inject(ctx, false); err != nil {
+		return nil, err
+	}
+	return p.upstream.CheckVersion(forwardContext(ctx), c)
+}
+
+// dialUpstream opens the proxy connection to the alpha at addr.
+func dialUpstream(ctx context.Context, addr string, opts ConnOptions) (*grpc.ClientConn, error) {
+	transportOpt := grpc.WithInsecure()
+	if opts.TLS != nil {
+		transportOpt = grpc.WithTransportCredentials(credentials.NewTLS(opts.TLS))
+	}
+	dialOpts := []grpc.DialOption{
+		transportOpt,
+		grpc.WithBlock(),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(maxRecvMsgSize),
+			grpc.MaxCallSendMsgSize(maxSendMsgSize),
+		),
+	}
+	if opts.Dialer != nil {
+		dialOpts = append(dialOpts, grpc.WithContextDialer(opts.Dialer))
+	}
+	conn, err := grpc.DialContext(ctx, addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial dgraph alpha server %s: %s", addr, err)
+	}
+	return conn, nil
+}
+
+// trackingListener keeps track of the connections it accepted so that they
+// can be reset.
+type trackingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+func newTrackingListener(ln net.Listener) *trackingListener {
+	return &trackingListener{Listener: ln, conns: make(map[*trackedConn]struct{})}
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{Conn: conn, l: l}
+	l.mu.Lock()
+	l.conns[tc] = struct{}{}
+	l.mu.Unlock()
+	return tc, nil
+}
+
+// resetAll closes the accepted connections, with a TCP reset rather than an
+// orderly shutdown where possible, and returns their number.
+func (l *trackingListener) resetAll() int {
+	l.mu.Lock()
+	conns := make([]*trackedConn, 0, len(l.conns))
+	for tc := range l.conns {
+		conns = append(conns, tc)
+	}
+	l.mu.Unlock()
+	for _, tc := range conns {
+		if tcp, ok := tc.Conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		tc.Close()
+	}
+	return len(conns)
+}
+
+type trackedConn struct {
+	net.Conn
+	l *trackingListener
+}
+
+func (c *trackedConn) Close() error {
+	c.l.mu.Lock()
+	delete(c.l.conns, c)
+	c.l.mu.Unlock()
+	return c.Conn.Close()
+}
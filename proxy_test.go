@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// proxyServer serves a faultProxy in front of a fake dgraph server.
+type proxyServer struct {
+	*faultProxy
+	upstream *fakeServer
+	lis      *bufconn.Listener
+	dials    int32
+}
+
+func startProxy(t *testing.T, cfg faultConfig) *proxyServer {
+	t.Helper()
+	fs := startFakeServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	conn, err := dialUpstream(ctx, "bufconn", fs.connOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ps := &proxyServer{
+		faultProxy: newFaultProxy(dgoapi.NewDgraphClient(conn), cfg),
+		upstream:   fs,
+		lis:        bufconn.Listen(1 << 20),
+	}
+	go ps.Serve(ctx, ps.lis)
+	return ps
+}
+
+// connect opens a GraphConnection to the proxy.
+func (ps *proxyServer) connect(t *testing.T) *GraphConnection {
+	t.Helper()
+	opts := ps.upstream.connOptions()
+	opts.Dialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		atomic.AddInt32(&ps.dials, 1)
+		return ps.lis.Dial()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	gc, err := NewGraphConnection(ctx, []string{"bufconn"}, opts, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unable to connect to proxy: %s", err)
+	}
+	t.Cleanup(gc.Close)
+	return gc
+}
+
+func testQuads() *Quads {
+	q := NewQuads()
+	q.SetQuadStr("_:a", "name", "a")
+	return q
+}
+
+func TestProxyForwards(t *testing.T) {
+	ps := startProxy(t, faultConfig{latency: time.Millisecond})
+	gc := ps.connect(t)
+
+	if err := gc.LoadSchema(context.Background(), Schema("name: string .")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := gc.Mutate(context.Background(), testQuads()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := len(ps.upstream.Alters()); n != 1 {
+		t.Errorf("expected 1 alter upstream, got %d", n)
+	}
+	if n := len(ps.upstream.Requests()); n != 1 {
+		t.Errorf("expected 1 request upstream, got %d", n)
+	}
+}
+
+func TestProxyAborts(t *testing.T) {
+	ps := startProxy(t, faultConfig{abortRate: 1})
+	gc := ps.connect(t)
+
+	if err := gc.LoadSchema(context.Background(), Schema("name: string .")); err != nil {
+		t.Fatalf("expected alters not to be aborted, got %s", err)
+	}
+	err := gc.Mutate(context.Background(), testQuads())
+	if ErrorCategoryOf(err) != ErrAborted {
+		t.Fatalf("expected an aborted error, got %v", err)
+	}
+	if n := len(ps.upstream.Requests()); n != 0 {
+		t.Errorf("expected no requests upstream, got %d", n)
+	}
+}
+
+func TestProxyResetReconnects(t *testing.T) {
+	ps := startProxy(t, faultConfig{})
+	gc := ps.connect(t)
+	if err := gc.Mutate(context.Background(), testQuads()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if n := ps.resetConnections(); n != 1 {
+		t.Errorf("expected 1 connection reset, got %d", n)
+	}
+	if err := gc.Mutate(context.Background(), testQuads()); err != nil {
+		t.Fatalf("expected the connection to recover, got %s", err)
+	}
+	if n := atomic.LoadInt32(&ps.dials); n < 2 {
+		t.Errorf("expected the proxy to be dialed again, got %d dials", n)
+	}
+}
+
+func TestProxyBlackhole(t *testing.T) {
+	ps := startProxy(t, faultConfig{})
+	gc := ps.connect(t)
+	ps.blackhole(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := gc.Mutate(ctx, testQuads())
+	if ErrorCategoryOf(err) != ErrDeadline {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	if n := len(ps.upstream.Requests()); n != 0 {
+		t.Errorf("expected no requests upstream, got %d", n)
+	}
+}
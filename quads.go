@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
 	"strings"
 
 	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
@@ -14,6 +16,7 @@ const (
 type UpsertID string
 
 type upsertQueryRecord struct {
+	index    int // order in which the query was added
 	id       UpsertID
 	field    string
 	value    string
@@ -24,6 +27,7 @@ type Quads struct {
 	setQuads  []*dgoapi.NQuad
 	delQuads  []*dgoapi.NQuad
 	upsertIDs map[string]upsertQueryRecord
+	err       error // first value rejected by the sanitizer
 }
 
 func NewQuads() *Quads {
@@ -33,12 +37,11 @@ func NewQuads() *Quads {
 }
 
 func CreateFacetString(key, value string) *dgoapi.Facet {
-	modValue := removeInvalidChars(value)
 	return &dgoapi.Facet{
 		Key:     key,
-		Value:   []byte(modValue),
+		Value:   []byte(value),
 		ValType: 0,
-		Tokens:  []string{modValue},
+		Tokens:  []string{value},
 	}
 }
 
@@ -51,22 +54,96 @@ func CreateFacetDatetime(key, value string) *dgoapi.Facet {
 	}
 }
 
+// facetBinary encodes a number facet value as dgraph does.
+func facetBinary(bits uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, bits)
+	return b
+}
+
+// CreateFacetInt creates an int facet.
+func CreateFacetInt(key string, value int64) *dgoapi.Facet {
+	return &dgoapi.Facet{Key: key, Value: facetBinary(uint64(value)), ValType: dgoapi.Facet_INT}
+}
+
+// CreateFacetFloat creates a float facet.
+func CreateFacetFloat(key string, value float64) *dgoapi.Facet {
+	return &dgoapi.Facet{Key: key, Value: facetBinary(math.Float64bits(value)), ValType: dgoapi.Facet_FLOAT}
+}
+
+// CreateFacetBool creates a bool facet.
+func CreateFacetBool(key string, value bool) *dgoapi.Facet {
+	b := []byte{0}
+	if value {
+		b[0] = 1
+	}
+	return &dgoapi.Facet{Key: key, Value: b, ValType: dgoapi.Facet_BOOL}
+}
+
 func NewFacetArray() []*dgoapi.Facet {
 	return []*dgoapi.Facet{}
 }
 
+// addSet sanitizes the string value and facets of a quad and adds it to the
+// quads to set. Quads with an empty string value are skipped.
+func (q *Quads) addSet(nq *dgoapi.NQuad) {
+	if sv, ok := nq.ObjectValue.GetVal().(*dgoapi.Value_StrVal); ok {
+		val, err := sanitizer.Value(sv.StrVal)
+		if err != nil {
+			q.reject(err)
+			return
+		}
+		if val == "" {
+			return
+		}
+		sv.StrVal = val
+	}
+	// The facets and their slice may be shared by several quads, so the
+	// sanitized ones are copied into a new slice.
+	if len(nq.Facets) > 0 {
+		facets := make([]*dgoapi.Facet, len(nq.Facets))
+		for i, f := range nq.Facets {
+			facets[i] = f
+			if f.ValType != dgoapi.Facet_STRING {
+				continue
+			}
+			val, err := sanitizer.Value(string(f.Value))
+			if err != nil {
+				q.reject(err)
+				return
+			}
+			nf := *f
+			nf.Value = []byte(val)
+			nf.Tokens = []string{val}
+			facets[i] = &nf
+		}
+		nq.Facets = facets
+	}
+	q.setQuads = append(q.setQuads, nq)
+}
+
+// reject records a value rejected by the sanitizer.
+func (q *Quads) reject(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// Err returns the first value rejected by the sanitizer since the quads were
+// cleared, if any.
+func (q *Quads) Err() error {
+	return q.err
+}
+
 // SetQuadStr adds a graph string type node property.
 func (q *Quads) SetQuadStr(sub, pred, obj string, facets ...*dgoapi.Facet) {
-	modObj := removeInvalidChars(obj)
-	if modObj != "" {
-		nq := &dgoapi.NQuad{
-			Subject:     sub,
-			Predicate:   pred,
-			ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_StrVal{StrVal: modObj}},
-			Facets:      facets,
-		}
-		q.setQuads = append(q.setQuads, nq)
+	nq := &dgoapi.NQuad{
+		Subject:     sub,
+		Predicate:   pred,
+		ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_StrVal{StrVal: obj}},
+		Facets:      facets,
 	}
+	q.addSet(nq)
 }
 
 // SetQuadInt64 adds a graph int type node property.
@@ -77,7 +154,7 @@ func (q *Quads) SetQuadInt64(sub, pred string, obj int64, facets ...*dgoapi.Face
 		ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_IntVal{IntVal: obj}},
 		Facets:      facets,
 	}
-	q.setQuads = append(q.setQuads, nq)
+	q.addSet(nq)
 }
 
 // SetQuadStr adds a graph bool type node property.
@@ -88,7 +165,7 @@ func (q *Quads) SetQuadBool(sub, pred string, obj bool, facets ...*dgoapi.Facet)
 		ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_BoolVal{BoolVal: obj}},
 		Facets:      facets,
 	}
-	q.setQuads = append(q.setQuads, nq)
+	q.addSet(nq)
 }
 
 // SetQuadRel adds a graph edge.
@@ -99,21 +176,18 @@ func (q *Quads) SetQuadRel(sub, pred, obj string, facets ...*dgoapi.Facet) {
 		ObjectId:  obj,
 		Facets:    facets,
 	}
-	q.setQuads = append(q.setQuads, nq)
+	q.addSet(nq)
 }
 
 // SetQuadStrUpsert adds a graph edge from an upsert node.
 func (q *Quads) SetQuadStrUpsert(id UpsertID, pred, obj string, facets ...*dgoapi.Facet) {
-	modObj := removeInvalidChars(obj)
-	if modObj != "" {
-		nq := &dgoapi.NQuad{
-			Subject:     fmt.Sprintf("uid(%s)", id),
-			Predicate:   pred,
-			ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_StrVal{StrVal: modObj}},
-			Facets:      facets,
-		}
-		q.setQuads = append(q.setQuads, nq)
+	nq := &dgoapi.NQuad{
+		Subject:     fmt.Sprintf("uid(%s)", id),
+		Predicate:   pred,
+		ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_StrVal{StrVal: obj}},
+		Facets:      facets,
 	}
+	q.addSet(nq)
 }
 
 // SetQuadBoolUpsert adds a graph bool type node property to an upsert node.
@@ -124,7 +198,7 @@ func (q *Quads) SetQuadBoolUpsert(id UpsertID, pred string, obj bool, facets ...
 		ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_BoolVal{BoolVal: obj}},
 		Facets:      facets,
 	}
-	q.setQuads = append(q.setQuads, nq)
+	q.addSet(nq)
 }
 
 // SetQuadRelUpsertFrom adds a graph edge from an upsert node.
@@ -135,7 +209,7 @@ func (q *Quads) SetQuadRelUpsertFrom(fromID UpsertID, pred, obj string, facets .
 		ObjectId:  obj,
 		Facets:    facets,
 	}
-	q.setQuads = append(q.setQuads, nq)
+	q.addSet(nq)
 }
 
 // SetQuadRelUpsertTo adds a graph edge to an upsert node.
@@ -146,7 +220,7 @@ func (q *Quads) SetQuadRelUpsertTo(sub, pred string, toID UpsertID, facets ...*d
 		ObjectId:  fmt.Sprintf("uid(%s)", toID),
 		Facets:    facets,
 	}
-	q.setQuads = append(q.setQuads, nq)
+	q.addSet(nq)
 }
 
 // SetQuadRelUpsertFromTo adds a graph edge from and upsert node to an upsert node.
@@ -157,7 +231,7 @@ func (q *Quads) SetQuadRelUpsertFromTo(fromID UpsertID, pred string, toID Upsert
 		ObjectId:  fmt.Sprintf("uid(%s)", toID),
 		Facets:    facets,
 	}
-	q.setQuads = append(q.setQuads, nq)
+	q.addSet(nq)
 }
 
 // DelQuadProp removes a graph node property.
@@ -180,14 +254,28 @@ func (q *Quads) DelQuadRel(sub, pred, obj string) {
 	q.delQuads = append(q.delQuads, nq)
 }
 
+// DelQuadNodeUpsert removes all the properties and edges of an upsert node.
+func (q *Quads) DelQuadNodeUpsert(id UpsertID) {
+	nq := &dgoapi.NQuad{
+		Subject:     fmt.Sprintf("uid(%s)", id),
+		Predicate:   "*",
+		ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_DefaultVal{DefaultVal: "_STAR_ALL"}},
+	}
+	q.delQuads = append(q.delQuads, nq)
+}
+
 // AddUpsertQuery adds an upsert query and returns its ID
 func (q *Quads) AddUpsertQuery(field, value, nodeType string) UpsertID {
 	var uqr upsertQueryRecord
 	var contains bool
-	modValue := removeInvalidChars(value)
+	modValue, err := sanitizer.Value(value)
+	if err != nil {
+		q.reject(err)
+	}
 	key := modValue + ":" + field + ":" + nodeType
 	if uqr, contains = q.upsertIDs[key]; !contains {
 		uqr = upsertQueryRecord{
+			index:    len(q.upsertIDs),
 			id:       UpsertID(fmt.Sprintf("upsert_id_%d", len(q.upsertIDs))),
 			field:    field,
 			value:    modValue,
@@ -198,6 +286,36 @@ func (q *Quads) AddUpsertQuery(field, value, nodeType string) UpsertID {
 	return uqr.id
 }
 
+// BlankNodeQuads returns the quads to set with the upsert variables replaced
+// by blank nodes named after the upserted values, so that they can be loaded
+// without the upsert query, and with prefix added to the other blank nodes.
+func (q *Quads) BlankNodeQuads(prefix string) []*dgoapi.NQuad {
+	blankNodes := make(map[string]string, len(q.upsertIDs))
+	for _, uqr := range q.upsertIDs {
+		blankNodes[fmt.Sprintf("uid(%s)", uqr.id)] = "_:" + uqr.value
+	}
+	rename := func(node string) string {
+		if bn, ok := blankNodes[node]; ok {
+			return bn
+		}
+		if strings.HasPrefix(node, "_:") {
+			return "_:" + prefix + node[2:]
+		}
+		return node
+	}
+
+	nqs := make([]*dgoapi.NQuad, len(q.setQuads))
+	for i, sq := range q.setQuads {
+		nq := *sq
+		nq.Subject = rename(nq.Subject)
+		if nq.ObjectId != "" {
+			nq.ObjectId = rename(nq.ObjectId)
+		}
+		nqs[i] = &nq
+	}
+	return nqs
+}
+
 // Size returns the quantity of quads to set and to delete
 func (q *Quads) Size() int {
 	return len(q.setQuads) + len(q.delQuads)
@@ -227,25 +345,19 @@ func (q *Quads) String() string {
 		buf.WriteString(q.upsertQuery())
 		buf.WriteString("\n\n")
 	}
-	if len(q.setQuads) > 0 {
-		buf.WriteString("# Set Quads\n")
-		for _, sq := range q.setQuads {
-			obj := sq.ObjectId
-			if obj == "" {
-				obj = "\"" + sq.ObjectValue.GetStrVal() + "\""
-			}
-			buf.WriteString(fmt.Sprintf("%s %s %s .\n", sq.Subject, sq.Predicate, obj))
+	for _, section := range []struct {
+		title string
+		nqs   []*dgoapi.NQuad
+	}{{"# Set Quads", q.setQuads}, {"# Del Quads", q.delQuads}} {
+		if len(section.nqs) == 0 {
+			continue
 		}
-	}
-	if len(q.delQuads) > 0 {
-		buf.WriteString("# Del Quads\n")
-		for _, dq := range q.delQuads {
-			obj := dq.ObjectId
-			if obj == "" {
-				obj = dq.ObjectValue.GetStrVal()
-			}
-			buf.WriteString(fmt.Sprintf("%s %s %s .\n", dq.Subject, dq.Predicate, obj))
+		buf.WriteString(section.title + "\n")
+		rdf, err := nquadsRDF(section.nqs)
+		if err != nil {
+			rdf = "# " + err.Error() + "\n"
 		}
+		buf.WriteString(rdf)
 	}
 	return buf.String()
 }
@@ -253,12 +365,14 @@ func (q *Quads) String() string {
 func (q *Quads) upsertQuery() string {
 	var buf strings.Builder
 	buf.WriteString("query {\n")
-	count := 0
+	records := make([]upsertQueryRecord, len(q.upsertIDs))
 	for _, uqr := range q.upsertIDs {
-		buf.WriteString(fmt.Sprintf("\tqu%d(func: eq(%s, \"%s\")) @filter(type(%s)) {\n", count, uqr.field, uqr.value, uqr.nodeType))
+		records[uqr.index] = uqr
+	}
+	for i, uqr := range records {
+		buf.WriteString(fmt.Sprintf("\tqu%d(func: eq(%s, %s)) @filter(type(%s)) {\n", i, uqr.field, dqlQuote(uqr.value), uqr.nodeType))
 		buf.WriteString(fmt.Sprintf("\t\t%s as uid\n", uqr.id))
 		buf.WriteString("\t}\n")
-		count++
 	}
 	buf.WriteString("}")
 	return buf.String()
@@ -266,6 +380,7 @@ func (q *Quads) upsertQuery() string {
 
 // Clear clears the quads
 func (q *Quads) Clear() {
+	q.err = nil
 	q.setQuads = nil
 	q.delQuads = nil
 	q.upsertIDs = make(map[string]upsertQueryRecord, upsertQueryMapSize)
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+)
+
+func TestQuadsRequest(t *testing.T) {
+	q := NewQuads()
+	q.SetQuadStr("_:a", "name", "a")
+	q.SetQuadInt64("_:a", "count", 3)
+	q.SetQuadRel("_:a", "LINK0", "_:b")
+	q.DelQuadProp("<0x1>", "name")
+
+	req := q.Request()
+	if !req.CommitNow || len(req.Mutations) != 1 || !req.Mutations[0].CommitNow {
+		t.Fatalf("expected a single mutation committed now, got %v", req)
+	}
+	if n := len(req.Mutations[0].Set); n != 3 {
+		t.Errorf("expected 3 set quads, got %d", n)
+	}
+	if n := len(req.Mutations[0].Del); n != 1 {
+		t.Errorf("expected 1 del quad, got %d", n)
+	}
+	if req.Query != "" {
+		t.Errorf("expected no upsert query, got %q", req.Query)
+	}
+	if q.Size() != 4 {
+		t.Errorf("expected size 4, got %d", q.Size())
+	}
+}
+
+func TestQuadsRequestUpsert(t *testing.T) {
+	q := NewQuads()
+	a := q.AddUpsertQuery("name", "Node-0.0.0", "Node0")
+	b := q.AddUpsertQuery("name", "Node-0.0.1", "Node1")
+	if a == b {
+		t.Fatalf("expected distinct upsert IDs, got %s twice", a)
+	}
+	if again := q.AddUpsertQuery("name", "Node-0.0.0", "Node0"); again != a {
+		t.Errorf("expected the upsert ID %s to be reused, got %s", a, again)
+	}
+	q.SetQuadRelUpsertFromTo(a, "LINK1", b)
+
+	req := q.Request()
+	for _, want := range []string{
+		`eq(name, "Node-0.0.0")) @filter(type(Node0))`,
+		`eq(name, "Node-0.0.1")) @filter(type(Node1))`,
+		string(a) + " as uid",
+		string(b) + " as uid",
+	} {
+		if !strings.Contains(req.Query, want) {
+			t.Errorf("expected the upsert query to contain %q, got:\n%s", want, req.Query)
+		}
+	}
+	set := req.Mutations[0].Set
+	if len(set) != 1 || set[0].Subject != "uid("+string(a)+")" || set[0].ObjectId != "uid("+string(b)+")" {
+		t.Errorf("unexpected set quads: %v", set)
+	}
+}
+
+func TestQuadsClear(t *testing.T) {
+	q := NewQuads()
+	q.AddUpsertQuery("name", "a", "Node0")
+	q.SetQuadStr("_:a", "name", "a")
+	q.DelQuadRel("_:a", "LINK0", "_:b")
+	q.Clear()
+	if q.Size() != 0 {
+		t.Errorf("expected no quads, got %d", q.Size())
+	}
+	if req := q.Request(); req.Query != "" {
+		t.Errorf("expected no upsert query, got %q", req.Query)
+	}
+}
+
+func TestQuadsFacetsNotShared(t *testing.T) {
+	facets := []*dgoapi.Facet{CreateFacetString("note", `a "b"`), CreateFacetInt("n", 1)}
+	orig := facets[0]
+	q := NewQuads()
+	q.SetQuadStr("_:a", "name", "a", facets...)
+	if facets[0] != orig || string(orig.Value) != `a "b"` {
+		t.Errorf("expected the caller's facets to be left alone, got %q", facets[0].Value)
+	}
+	if got := string(q.setQuads[0].Facets[0].Value); got != "a b" {
+		t.Errorf("expected the quad's facet to be stripped, got %q", got)
+	}
+}
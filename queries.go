@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Query types exercising the indexes and edges of the generated graph.
+const (
+	queryNameTerm = "name-term" // term search on name
+	queryPredHash = "pred-hash" // hash lookup on a predN value
+	queryNextHops = "next-hops" // recursive traversal over NEXT
+	queryLinkHops = "link-hops" // nested traversal over random LINKk edges
+)
+
+var queryTypes = []string{queryNameTerm, queryPredHash, queryNextHops, queryLinkHops}
+
+// queryConfig holds the flags of the query workload. The graph flags must
+// match the test that generated the graph so that the queries can find its
+// nodes.
+type queryConfig struct {
+	graph        string
+	graphWorkers int
+	graphRounds  int
+	types        []string
+	hops         int
+}
+
+// queryWorkload queries the graph written by a generator, cycling through the
+// query types.
+type queryWorkload struct {
+	dgc  *GraphConnection
+	gen  Generator
+	cfg  testConfig
+	qcfg queryConfig
+}
+
+func newQueryWorkload(dgc *GraphConnection, gen Generator, cfg testConfig, qcfg queryConfig) (*queryWorkload, error) {
+	for _, qt := range qcfg.types {
+		if !containsString(queryTypes, qt) {
+			return nil, fmt.Errorf("unknown query type %q; must be one of %s", qt, strings.Join(queryTypes, ", "))
+		}
+	}
+	if cfg.nodeTypeCount < 1 {
+		return nil, fmt.Errorf("the query workload needs at least one node type")
+	}
+	if len(qcfg.types) == 0 {
+		for _, qt := range queryTypes {
+			// The graph has no predicates for the hash lookups.
+			if qt != queryPredHash || cfg.nodePredCount > 0 {
+				qcfg.types = append(qcfg.types, qt)
+			}
+		}
+	} else if cfg.nodePredCount < 1 && containsString(qcfg.types, queryPredHash) {
+		return nil, fmt.Errorf("the %s query type needs at least one node predicate", queryPredHash)
+	}
+	if qcfg.graphWorkers < 1 {
+		qcfg.graphWorkers = 1
+	}
+	return &queryWorkload{dgc: dgc, gen: gen, cfg: cfg, qcfg: qcfg}, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (wl *queryWorkload) Header() string {
+	return fmt.Sprintf("Test Query: %d rounds; %s graph of %d rounds by %d workers; query types %s; %d hops",
+		wl.cfg.rounds, wl.qcfg.graph, wl.qcfg.graphRounds, wl.qcfg.graphWorkers, strings.Join(wl.qcfg.types, ","), wl.qcfg.hops)
+}
+
+func (wl *queryWorkload) Do(ctx context.Context, w *worker, round int) opResult {
+	qt := wl.qcfg.types[(w.id+round)%len(wl.qcfg.types)]
+	query, vars := wl.buildQuery(w.rng, qt)
+
+	startTime := time.Now()
+	_, err := wl.dgc.Query(ctx, query, vars)
+	endTime := time.Now()
+	return opResult{op: qt, latency: endTime.Sub(startTime), err: err}
+}
+
+// randomNode returns the name and type of a random node of the graph.
+func (wl *queryWorkload) randomNode(rng *rand.Rand) (name, nodeType string) {
+	gw := rng.Intn(wl.qcfg.graphWorkers)
+	round := 0
+	if n := splitRounds(wl.qcfg.graphRounds, wl.qcfg.graphWorkers, gw); n > 0 {
+		round = rng.Intn(n)
+	}
+	i := rng.Intn(wl.cfg.nodeTypeCount)
+	return wl.gen.NodeName(gw, round, i), fmt.Sprintf("Node%d", i)
+}
+
+// buildQuery returns a query of the given type and its variables.
+func (wl *queryWorkload) buildQuery(rng *rand.Rand, qt string) (string, map[string]string) {
+	name, nodeType := wl.randomNode(rng)
+	var buf strings.Builder
+	switch qt {
+	case queryNameTerm:
+		buf.WriteString("query q($name: string) {\n")
+		buf.WriteString("\tq(func: allofterms(name, $name)) {\n\t\tuid\n\t\tname\n\t}\n")
+	case queryPredHash:
+		buf.WriteString("query q($value: string) {\n")
+		buf.WriteString(fmt.Sprintf("\tq(func: eq(pred%d, $value), first: 100) {\n\t\tuid\n\t\tname\n\t}\n", rng.Intn(wl.cfg.nodePredCount)))
+		buf.WriteString("}")
+		return buf.String(), map[string]string{"$value": lessRandomString(rng, wl.cfg.predStringLen)}
+	case queryNextHops:
+		buf.WriteString("query q($name: string) {\n")
+		buf.WriteString(fmt.Sprintf("\tq(func: eq(name, $name)) @filter(type(%s)) @recurse(depth: %d) {\n", nodeType, wl.qcfg.hops))
+		buf.WriteString("\t\tuid\n\t\tname\n\t\tNEXT\n\t}\n")
+	case queryLinkHops:
+		buf.WriteString("query q($name: string) {\n")
+		buf.WriteString(fmt.Sprintf("\tq(func: eq(name, $name)) @filter(type(%s)) {\n", nodeType))
+		indent := "\t\t"
+		for h := 0; h < wl.qcfg.hops; h++ {
+			buf.WriteString(fmt.Sprintf("%suid\n%sname\n%sLINK%d {\n", indent, indent, indent, rng.Intn(wl.cfg.nodeTypeCount)))
+			indent += "\t"
+		}
+		buf.WriteString(fmt.Sprintf("%suid\n%sname\n", indent, indent))
+		for h := wl.qcfg.hops; h >= 0; h-- {
+			indent = indent[:len(indent)-1]
+			buf.WriteString(indent + "}\n")
+		}
+	}
+	buf.WriteString("}")
+	return buf.String(), map[string]string{"$name": name}
+}
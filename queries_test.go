@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestQueryWorkloadConfig(t *testing.T) {
+	cfg := testConfig{nodeTypeCount: 2, nodePredCount: 0, predStringLen: 8}
+	qcfg := queryConfig{graph: "fully-connected", graphRounds: 10, hops: 2}
+	gen := newFullyConnectedGenerator(cfg)
+
+	wl, err := newQueryWorkload(nil, gen, cfg, qcfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := []string{queryNameTerm, queryNextHops, queryLinkHops}; !reflect.DeepEqual(wl.qcfg.types, want) {
+		t.Errorf("expected the default types without predicates to be %v, got %v", want, wl.qcfg.types)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, qt := range wl.qcfg.types {
+		if query, _ := wl.buildQuery(rng, qt); query == "" {
+			t.Errorf("%s: expected a query", qt)
+		}
+	}
+
+	qcfg.types = []string{queryPredHash}
+	if _, err := newQueryWorkload(nil, gen, cfg, qcfg); err == nil {
+		t.Errorf("expected an error for %s queries without predicates", queryPredHash)
+	}
+	qcfg.types = nil
+	cfg.nodeTypeCount = 0
+	if _, err := newQueryWorkload(nil, gen, cfg, qcfg); err == nil {
+		t.Error("expected an error without node types")
+	}
+}
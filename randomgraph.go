@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Defaults of the random graph flags.
+const (
+	defaultMeanDegree         = 4
+	defaultDegreeDistribution = "power-law:2.5"
+)
+
+// degreeDistribution is the distribution of the node degrees of a random
+// graph: fixed:D, uniform:MIN-MAX or power-law:EXPONENT. It is a kingpin flag
+// value, so that invalid distributions are rejected when parsing the flags.
+type degreeDistribution struct {
+	kind string
+	a, b float64
+}
+
+func (d *degreeDistribution) Set(spec string) error {
+	kv := strings.SplitN(spec, ":", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("invalid degree distribution %q: must be fixed:D, uniform:MIN-MAX or power-law:EXPONENT", spec)
+	}
+	switch kv[0] {
+	case "fixed":
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid degree distribution %q: the degree must be a non-negative integer", spec)
+		}
+		d.a = float64(n)
+	case "uniform":
+		bounds := strings.SplitN(kv[1], "-", 2)
+		if len(bounds) != 2 {
+			return fmt.Errorf("invalid degree distribution %q: must be uniform:MIN-MAX", spec)
+		}
+		min, err1 := strconv.Atoi(bounds[0])
+		max, err2 := strconv.Atoi(bounds[1])
+		if err1 != nil || err2 != nil || min < 0 || max < min {
+			return fmt.Errorf("invalid degree distribution %q: the degrees must be integers with 0 <= MIN <= MAX", spec)
+		}
+		d.a, d.b = float64(min), float64(max)
+	case "power-law":
+		exp, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || exp <= 1 {
+			return fmt.Errorf("invalid degree distribution %q: the exponent must be a number above 1", spec)
+		}
+		d.a = exp
+	default:
+		return fmt.Errorf("invalid degree distribution %q: unknown distribution %s", spec, kv[0])
+	}
+	d.kind = kv[0]
+	return nil
+}
+
+func (d *degreeDistribution) String() string {
+	switch d.kind {
+	case "fixed":
+		return fmt.Sprintf("fixed:%g", d.a)
+	case "uniform":
+		return fmt.Sprintf("uniform:%g-%g", d.a, d.b)
+	case "power-law":
+		return fmt.Sprintf("power-law:%g", d.a)
+	}
+	return ""
+}
+
+// sample returns a degree drawn from the distribution, at most max.
+func (d *degreeDistribution) sample(rng *rand.Rand, max int) int {
+	var deg float64
+	switch d.kind {
+	case "fixed":
+		deg = d.a
+	case "uniform":
+		deg = d.a + float64(rng.Intn(int(d.b-d.a)+1))
+	case "power-law":
+		// Inverse transform sampling of a power law with a minimum of 1,
+		// which can exceed the range of an int for exponents close to 1.
+		deg = math.Pow(1-rng.Float64(), -1/(d.a-1))
+	}
+	if deg > float64(max) {
+		return max
+	}
+	return int(deg)
+}
+
+// graphStats describes the graphs built by a generator.
+type graphStats struct {
+	nodes     int64
+	edges     int64
+	maxDegree int
+}
+
+func (s graphStats) String() string {
+	var mean float64
+	if s.nodes > 0 {
+		mean = 2 * float64(s.edges) / float64(s.nodes)
+	}
+	return fmt.Sprintf("%d nodes; %d edges; mean degree %.2f; max degree %d", s.nodes, s.edges, mean, s.maxDegree)
+}
+
+// randomGraph is the undirected graph written by a worker, with node n
+// written by round n / node types as type n % node types. Every edge is kept
+// with its later node, which links to the earlier one when it is written.
+type randomGraph struct {
+	offsets []int32 // edges of node n are earlier[offsets[n]:offsets[n+1]]
+	earlier []int32
+}
+
+// newRandomGraph returns the graph of n nodes with the edges from[i]-to[i],
+// adding its stats to stats. Self loops and duplicate edges are dropped.
+func newRandomGraph(n int, from, to []int32, stats *graphStats) *randomGraph {
+	g := &randomGraph{offsets: make([]int32, n+1)}
+	for i := range from {
+		if from[i] != to[i] {
+			g.offsets[max32(from[i], to[i])+1]++
+		}
+	}
+	for i := 1; i <= n; i++ {
+		g.offsets[i] += g.offsets[i-1]
+	}
+	g.earlier = make([]int32, g.offsets[n])
+	next := append([]int32(nil), g.offsets[:n]...)
+	for i := range from {
+		if u, v := from[i], to[i]; u != v {
+			later := max32(u, v)
+			g.earlier[next[later]] = u + v - later
+			next[later]++
+		}
+	}
+
+	// Sort the links of every node to drop the duplicates, moving the links
+	// left behind the ones dropped.
+	degree := make([]int32, n)
+	kept := int32(0)
+	for u := 0; u < n; u++ {
+		links := g.earlier[g.offsets[u]:g.offsets[u+1]]
+		sort.Slice(links, func(i, j int) bool { return links[i] < links[j] })
+		g.offsets[u] = kept
+		prev := int32(-1)
+		for _, v := range links {
+			if v == prev {
+				continue
+			}
+			prev = v
+			g.earlier[kept] = v
+			kept++
+			degree[u]++
+			degree[v]++
+		}
+	}
+	g.offsets[n] = kept
+	g.earlier = g.earlier[:kept]
+
+	stats.nodes += int64(n)
+	stats.edges += int64(kept)
+	for _, d := range degree {
+		if int(d) > stats.maxDegree {
+			stats.maxDegree = int(d)
+		}
+	}
+	return g
+}
+
+func max32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// nodes returns the number of nodes of the graph.
+func (g *randomGraph) nodes() int {
+	return len(g.offsets) - 1
+}
+
+// links returns the earlier nodes linked to node n.
+func (g *randomGraph) links(n int) []int32 {
+	if n >= g.nodes() {
+		return nil
+	}
+	return g.earlier[g.offsets[n]:g.offsets[n+1]]
+}
+
+// erdosRenyiEdges returns the edges of a G(n, p) random graph, where every
+// pair of nodes is linked with probability p, skipping over the pairs left
+// unlinked with geometric jumps (Batagelj and Brandes, 2005).
+func erdosRenyiEdges(rng *rand.Rand, n int, p float64) (from, to []int32) {
+	if p <= 0 || n < 2 {
+		return nil, nil
+	}
+	if p >= 1 {
+		for v := 1; v < n; v++ {
+			for w := 0; w < v; w++ {
+				from, to = append(from, int32(v)), append(to, int32(w))
+			}
+		}
+		return from, to
+	}
+	lp := math.Log(1 - p)
+	pairs := float64(n) * float64(n)
+	for v, w := 1, -1; v < n; {
+		skip := math.Log(1-rng.Float64()) / lp
+		if skip > pairs {
+			break
+		}
+		w += 1 + int(skip)
+		for w >= v && v < n {
+			w -= v
+			v++
+		}
+		if v < n {
+			from, to = append(from, int32(v)), append(to, int32(w))
+		}
+	}
+	return from, to
+}
+
+// configurationEdges returns the edges of a random graph whose node degrees
+// are drawn from dist, pairing the edge ends of the nodes at random (the
+// configuration model). The self loops and duplicate edges this creates are
+// dropped later, so the actual degrees may be slightly lower.
+func configurationEdges(rng *rand.Rand, n int, dist *degreeDistribution) (from, to []int32) {
+	var ends []int32
+	for v := 0; v < n; v++ {
+		for d := dist.sample(rng, n-1); d > 0; d-- {
+			ends = append(ends, int32(v))
+		}
+	}
+	rng.Shuffle(len(ends), func(i, j int) { ends[i], ends[j] = ends[j], ends[i] })
+	for i := 0; i+1 < len(ends); i += 2 {
+		from, to = append(from, ends[i]), append(to, ends[i+1])
+	}
+	return from, to
+}
+
+// Creates random graphs with the edges drawn by a model from the seed. Each
+// worker writes its own graph, with the nodes of its rounds, which are built
+// before the test so that their stats can be reported.
+type randomGraphGenerator struct {
+	cfg    testConfig
+	model  string
+	graphs []*randomGraph
+	stats  graphStats
+}
+
+// newRandomGraphGenerator builds the graphs of the workers, drawing the edges
+// of a graph of n nodes with the edges function.
+func newRandomGraphGenerator(cfg testConfig, model string, edges func(rng *rand.Rand, n int) (from, to []int32)) *randomGraphGenerator {
+	g := &randomGraphGenerator{cfg: cfg, model: model}
+	workers := cfg.workers
+	if workers < 1 {
+		workers = 1
+	}
+	rng := rand.New(rand.NewSource(cfg.seed))
+	for w := 0; w < workers; w++ {
+		n := 0
+		if cfg.rounds > 0 {
+			n = splitRounds(cfg.rounds, workers, w) * cfg.nodeTypeCount
+		}
+		from, to := edges(rng, n)
+		g.graphs = append(g.graphs, newRandomGraph(n, from, to, &g.stats))
+	}
+	return g
+}
+
+// newErdosRenyiGenerator returns a generator of Erdős–Rényi graphs, with the
+// edge probability set or derived from the mean degree.
+func newErdosRenyiGenerator(cfg testConfig) Generator {
+	model := fmt.Sprintf("Erdős–Rényi, p=%g", cfg.edgeProbability)
+	if cfg.edgeProbability <= 0 {
+		model = fmt.Sprintf("Erdős–Rényi, mean degree %g", cfg.meanDegree)
+	}
+	return newRandomGraphGenerator(cfg, model, func(rng *rand.Rand, n int) (from, to []int32) {
+		p := cfg.edgeProbability
+		if p <= 0 && n > 1 {
+			p = cfg.meanDegree / float64(n-1)
+		}
+		return erdosRenyiEdges(rng, n, p)
+	})
+}
+
+// newRandomDegreeGenerator returns a generator of random graphs with the
+// degree distribution set.
+func newRandomDegreeGenerator(cfg testConfig) Generator {
+	model := fmt.Sprintf("degree distribution %s", &cfg.degrees)
+	return newRandomGraphGenerator(cfg, model, func(rng *rand.Rand, n int) (from, to []int32) {
+		return configurationEdges(rng, n, &cfg.degrees)
+	})
+}
+
+func (g *randomGraphGenerator) Header() string {
+	return fmt.Sprintf("Test Random Graph (%s): %d rounds; %d node types; %d predicates; %s", g.model, g.cfg.rounds, g.cfg.nodeTypeCount, g.cfg.nodePredCount, g.stats)
+}
+
+func (g *randomGraphGenerator) Static() bool {
+	return false
+}
+
+func (g *randomGraphGenerator) NodeName(worker, round, i int) string {
+	return nodeName(worker, round, i)
+}
+
+func (g *randomGraphGenerator) Round(q *Quads, rng *rand.Rand, worker, round int) {
+	types := g.cfg.nodeTypeCount
+	for i := 0; i < types; i++ {
+		name := nodeName(worker, round, i)
+		nodeType := fmt.Sprintf("Node%d", i)
+		upsertIDCurrent := q.AddUpsertQuery("name", name, nodeType)
+
+		q.SetQuadStrUpsert(upsertIDCurrent, "dgraph.type", nodeType)
+		q.SetQuadStrUpsert(upsertIDCurrent, "name", name)
+		for j := 0; j < g.cfg.nodePredCount; j++ {
+			q.SetQuadStrUpsert(upsertIDCurrent, fmt.Sprintf("pred%d", j), randomString(rng, g.cfg.predStringLen))
+		}
+
+		if worker >= len(g.graphs) {
+			continue
+		}
+		for _, n := range g.graphs[worker].links(round*types + i) {
+			linkRound, k := int(n)/types, int(n)%types
+			upsertIDLink := q.AddUpsertQuery("name", nodeName(worker, linkRound, k), fmt.Sprintf("Node%d", k))
+			q.SetQuadRelUpsertFromTo(upsertIDCurrent, fmt.Sprintf("LINK%d", k), upsertIDLink)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// writeLinks writes the rounds of every worker and returns the number of
+// LINK edges written.
+func writeLinks(gen Generator, cfg testConfig) int {
+	links := 0
+	for w := 0; w < cfg.workers; w++ {
+		rng := rand.New(rand.NewSource(1))
+		for round := 0; round < splitRounds(cfg.rounds, cfg.workers, w); round++ {
+			q := NewQuads()
+			gen.Round(q, rng, w, round)
+			for _, nq := range q.setQuads {
+				if strings.HasPrefix(nq.Predicate, "LINK") {
+					links++
+				}
+			}
+		}
+	}
+	return links
+}
+
+func TestErdosRenyiGenerator(t *testing.T) {
+	cfg := testConfig{nodeTypeCount: 2, nodePredCount: 1, predStringLen: 8, rounds: 2000, workers: 2, meanDegree: 6, seed: 1}
+	gen := newErdosRenyiGenerator(cfg).(*randomGraphGenerator)
+	stats := gen.stats
+	if stats.nodes != 4000 {
+		t.Errorf("expected 4000 nodes, got %d", stats.nodes)
+	}
+	if mean := 2 * float64(stats.edges) / float64(stats.nodes); mean < 5.5 || mean > 6.5 {
+		t.Errorf("expected a mean degree of about 6, got %.2f", mean)
+	}
+	if stats.maxDegree < 6 || stats.maxDegree > 30 {
+		t.Errorf("expected a max degree a little above the mean, got %d", stats.maxDegree)
+	}
+	if n := writeLinks(gen, cfg); int64(n) != stats.edges {
+		t.Errorf("expected the rounds to write the %d edges, got %d", stats.edges, n)
+	}
+	if !strings.Contains(gen.Header(), stats.String()) {
+		t.Errorf("expected the header to report the graph stats, got %q", gen.Header())
+	}
+
+	if again := newErdosRenyiGenerator(cfg).(*randomGraphGenerator); again.stats != stats {
+		t.Errorf("expected the same graph from the same seed, got %s and %s", stats, again.stats)
+	}
+	cfg.seed = 2
+	if other := newErdosRenyiGenerator(cfg).(*randomGraphGenerator); other.stats == stats {
+		t.Errorf("expected different graphs from different seeds, got %s twice", stats)
+	}
+
+	cfg.edgeProbability = 1
+	cfg.rounds, cfg.workers = 5, 1
+	full := newErdosRenyiGenerator(cfg).(*randomGraphGenerator).stats
+	if full.edges != 45 || full.maxDegree != 9 {
+		t.Errorf("expected a complete graph of 10 nodes, got %s", full)
+	}
+}
+
+func TestRandomDegreeGenerator(t *testing.T) {
+	cfg := testConfig{nodeTypeCount: 2, nodePredCount: 1, predStringLen: 8, rounds: 1000, workers: 1, seed: 1}
+	if err := cfg.degrees.Set("fixed:3"); err != nil {
+		t.Fatal(err)
+	}
+	gen := newRandomDegreeGenerator(cfg).(*randomGraphGenerator)
+	stats := gen.stats
+	if mean := 2 * float64(stats.edges) / float64(stats.nodes); mean < 2.9 || mean > 3 {
+		t.Errorf("expected a mean degree just under 3, got %.2f", mean)
+	}
+	if stats.maxDegree != 3 {
+		t.Errorf("expected a max degree of 3, got %d", stats.maxDegree)
+	}
+	if n := writeLinks(gen, cfg); int64(n) != stats.edges {
+		t.Errorf("expected the rounds to write the %d edges, got %d", stats.edges, n)
+	}
+
+	if err := cfg.degrees.Set("power-law:2.2"); err != nil {
+		t.Fatal(err)
+	}
+	stats = newRandomDegreeGenerator(cfg).(*randomGraphGenerator).stats
+	if mean := 2 * float64(stats.edges) / float64(stats.nodes); float64(stats.maxDegree) < 10*mean {
+		t.Errorf("expected hub nodes with a degree far above the mean %.2f, got a max of %d", mean, stats.maxDegree)
+	}
+}
+
+func TestDegreeDistributionSample(t *testing.T) {
+	var d degreeDistribution
+	if err := d.Set("power-law:1.1"); err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	capped := 0
+	for i := 0; i < 10000; i++ {
+		deg := d.sample(rng, 1000)
+		if deg < 1 || deg > 1000 {
+			t.Fatalf("expected degrees from 1 to 1000, got %d", deg)
+		}
+		if deg == 1000 {
+			capped++
+		}
+	}
+	if capped == 0 {
+		t.Error("expected the largest degrees to be capped at the maximum")
+	}
+}
+
+func TestDegreeDistributionSet(t *testing.T) {
+	for _, spec := range []string{"fixed:4", "uniform:1-8", "power-law:2.5"} {
+		var d degreeDistribution
+		if err := d.Set(spec); err != nil {
+			t.Errorf("%s: unexpected error: %s", spec, err)
+		} else if d.String() != spec {
+			t.Errorf("%s: expected the same spec back, got %s", spec, d.String())
+		}
+	}
+	for _, spec := range []string{"", "fixed", "fixed:-1", "uniform:8-1", "uniform:3", "power-law:1", "normal:3"} {
+		var d degreeDistribution
+		if err := d.Set(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestRandomGraphNeedsRounds(t *testing.T) {
+	for _, name := range []string{"random", "random-degree"} {
+		tc := findTest(name)
+		if err := tc.checkConfig(testConfig{rounds: 0}); err == nil {
+			t.Errorf("%s: expected an error without a bounded number of rounds", name)
+		}
+		if err := tc.checkConfig(testConfig{rounds: 10}); err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+		}
+	}
+	if err := findTest("scale-free").checkConfig(testConfig{rounds: 0}); err != nil {
+		t.Errorf("scale-free: unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+)
+
+// xsPrefix is the IRI prefix of the XML schema types abbreviated as "xs:".
+const xsPrefix = "http://www.w3.org/2001/XMLSchema#"
+
+// SetRDF returns the quads to set in RDF N-Quad format.
+func (q *Quads) SetRDF() (string, error) {
+	return nquadsRDF(q.setQuads)
+}
+
+// DelRDF returns the quads to delete in RDF N-Quad format.
+func (q *Quads) DelRDF() (string, error) {
+	return nquadsRDF(q.delQuads)
+}
+
+// LoadRDF adds the quads to set and to delete parsed from RDF N-Quads.
+// Upsert variables are kept as uid(...) nodes, but their upsert queries are
+// not part of the RDF and must be added separately.
+func (q *Quads) LoadRDF(set, del string) error {
+	setQuads, err := ParseRDF(strings.NewReader(set))
+	if err != nil {
+		return fmt.Errorf("unable to parse set quads: %s", err)
+	}
+	delQuads, err := ParseRDF(strings.NewReader(del))
+	if err != nil {
+		return fmt.Errorf("unable to parse del quads: %s", err)
+	}
+	q.setQuads = append(q.setQuads, setQuads...)
+	q.delQuads = append(q.delQuads, delQuads...)
+	return nil
+}
+
+// nquadsRDF renders quads in RDF N-Quad format, one per line.
+func nquadsRDF(nqs []*dgoapi.NQuad) (string, error) {
+	var buf strings.Builder
+	for _, nq := range nqs {
+		line, err := formatNQuad(nq)
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.String(), nil
+}
+
+// formatNQuad renders a quad as an RDF N-Quad line, with its facets.
+// String values are written as plain literals and parsed back as strings.
+func formatNQuad(nq *dgoapi.NQuad) (string, error) {
+	var buf strings.Builder
+	buf.WriteString(rdfNode(nq.Subject))
+	buf.WriteByte(' ')
+	if nq.Predicate == "*" {
+		buf.WriteString("*")
+	} else {
+		buf.WriteString("<" + nq.Predicate + ">")
+	}
+	buf.WriteByte(' ')
+	if nq.ObjectId != "" {
+		buf.WriteString(rdfNode(nq.ObjectId))
+	} else {
+		obj, err := rdfValue(nq.ObjectValue)
+		if err != nil {
+			return "", fmt.Errorf("unable to render quad %s <%s>: %s", nq.Subject, nq.Predicate, err)
+		}
+		buf.WriteString(obj)
+		if nq.Lang != "" {
+			buf.WriteString("@" + nq.Lang)
+		}
+	}
+	if nq.Label != "" {
+		buf.WriteString(" <" + nq.Label + ">")
+	}
+	if len(nq.Facets) > 0 {
+		buf.WriteString(" (")
+		for i, f := range nq.Facets {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(f.Key + "=" + rdfFacetValue(f))
+		}
+		buf.WriteString(")")
+	}
+	buf.WriteString(" .")
+	return buf.String(), nil
+}
+
+// rdfNode renders a subject or object node: blank nodes, uid variables and
+// IRIs in angle brackets are kept as is, and uids are put in angle brackets.
+func rdfNode(node string) string {
+	if strings.HasPrefix(node, "_:") || strings.HasPrefix(node, "uid(") || strings.HasPrefix(node, "<") {
+		return node
+	}
+	return "<" + node + ">"
+}
+
+// rdfValue renders a quad value as an RDF literal, typed unless it is a
+// string, or as the node of a uid value. Dates are rendered as datetimes.
+// Geo values are rejected: dgraph holds them in binary (WKB) form, which would
+// need a geometry library to render as the geo:geojson literals it parses.
+func rdfValue(v *dgoapi.Value) (string, error) {
+	switch val := v.GetVal().(type) {
+	case nil:
+		return "", fmt.Errorf("missing value")
+	case *dgoapi.Value_StrVal:
+		return rdfQuote(val.StrVal), nil
+	case *dgoapi.Value_DefaultVal:
+		if val.DefaultVal == "_STAR_ALL" {
+			return "*", nil
+		}
+		return rdfQuote(val.DefaultVal), nil
+	case *dgoapi.Value_IntVal:
+		return rdfQuote(strconv.FormatInt(val.IntVal, 10)) + "^^<xs:int>", nil
+	case *dgoapi.Value_BoolVal:
+		return rdfQuote(strconv.FormatBool(val.BoolVal)) + "^^<xs:boolean>", nil
+	case *dgoapi.Value_DoubleVal:
+		return rdfQuote(strconv.FormatFloat(val.DoubleVal, 'g', -1, 64)) + "^^<xs:double>", nil
+	case *dgoapi.Value_PasswordVal:
+		return rdfQuote(val.PasswordVal) + "^^<xs:password>", nil
+	case *dgoapi.Value_BytesVal:
+		return rdfQuote(base64.StdEncoding.EncodeToString(val.BytesVal)) + "^^<xs:base64Binary>", nil
+	case *dgoapi.Value_DatetimeVal:
+		t, err := binaryTime(val.DatetimeVal)
+		if err != nil {
+			return "", err
+		}
+		return rdfQuote(t) + "^^<xs:dateTime>", nil
+	case *dgoapi.Value_DateVal:
+		t, err := binaryTime(val.DateVal)
+		if err != nil {
+			return "", err
+		}
+		return rdfQuote(t) + "^^<xs:dateTime>", nil
+	case *dgoapi.Value_UidVal:
+		return fmt.Sprintf("<%#x>", val.UidVal), nil
+	case *dgoapi.Value_GeoVal:
+		return "", fmt.Errorf("geo values are not supported")
+	default:
+		return "", fmt.Errorf("unsupported value type %T", val)
+	}
+}
+
+// rdfFacetValue renders a facet value: strings are quoted, datetimes and
+// numbers are not.
+func rdfFacetValue(f *dgoapi.Facet) string {
+	switch val := facetValue(f).(type) {
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		s := strconv.FormatFloat(val, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEnN") {
+			s += ".0" // keep it a float when parsed back
+		}
+		return s
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	if f.ValType == dgoapi.Facet_DATETIME {
+		return string(f.Value)
+	}
+	return rdfQuote(string(f.Value))
+}
+
+// rdfQuote quotes a string as an RDF literal.
+func rdfQuote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if unicode.IsControl(r) {
+				buf.WriteString(fmt.Sprintf(`\u%04X`, r))
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// ParseRDF parses RDF N-Quads, one per line, as written by the dgraph
+// clients and loaders. Blank lines and "#" comment lines are skipped.
+func ParseRDF(r io.Reader) ([]*dgoapi.NQuad, error) {
+	var nqs []*dgoapi.NQuad
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRecvMsgSize)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		nq, err := parseNQuad(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		nqs = append(nqs, nq)
+	}
+	return nqs, scanner.Err()
+}
+
+// rdfScanner reads the terms of an N-Quad line.
+type rdfScanner struct {
+	line string
+	pos  int
+}
+
+func (s *rdfScanner) skipSpace() {
+	for s.pos < len(s.line) && (s.line[s.pos] == ' ' || s.line[s.pos] == '\t') {
+		s.pos++
+	}
+}
+
+func (s *rdfScanner) peek() byte {
+	if s.pos >= len(s.line) {
+		return 0
+	}
+	return s.line[s.pos]
+}
+
+func (s *rdfScanner) consume(prefix string) bool {
+	if strings.HasPrefix(s.line[s.pos:], prefix) {
+		s.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+// until returns the text up to the first of the stop bytes, or the end of
+// the line, leaving the position on the stop byte.
+func (s *rdfScanner) until(stops string) string {
+	start := s.pos
+	for s.pos < len(s.line) && !strings.ContainsRune(stops, rune(s.line[s.pos])) {
+		s.pos++
+	}
+	return s.line[start:s.pos]
+}
+
+// iri reads an IRI in angle brackets and returns it without them.
+func (s *rdfScanner) iri() (string, error) {
+	if !s.consume("<") {
+		return "", fmt.Errorf("expected '<' at column %d", s.pos+1)
+	}
+	iri := s.until(">")
+	if !s.consume(">") {
+		return "", fmt.Errorf("unterminated IRI <%s", iri)
+	}
+	if iri == "" {
+		return "", fmt.Errorf("empty IRI at column %d", s.pos)
+	}
+	return iri, nil
+}
+
+// node reads a subject or object node: an IRI, blank node or uid variable.
+func (s *rdfScanner) node() (string, error) {
+	switch {
+	case s.peek() == '<':
+		return s.iri()
+	case strings.HasPrefix(s.line[s.pos:], "_:"):
+		node := s.until(" \t")
+		if len(node) == 2 {
+			return "", fmt.Errorf("empty blank node at column %d", s.pos)
+		}
+		return node, nil
+	case strings.HasPrefix(s.line[s.pos:], "uid("):
+		node := s.until(")")
+		if !s.consume(")") {
+			return "", fmt.Errorf("unterminated uid variable %s", node)
+		}
+		return node + ")", nil
+	}
+	return "", fmt.Errorf("expected a node at column %d", s.pos+1)
+}
+
+// literal reads a quoted literal and returns it unescaped.
+func (s *rdfScanner) literal() (string, error) {
+	start := s.pos
+	s.pos++ // opening quote
+	var buf strings.Builder
+	for s.pos < len(s.line) {
+		c := s.line[s.pos]
+		switch {
+		case c == '"':
+			s.pos++
+			return buf.String(), nil
+		case c == '\\':
+			if s.pos+1 >= len(s.line) {
+				return "", fmt.Errorf("unterminated escape in literal at column %d", s.pos+1)
+			}
+			esc := s.line[s.pos+1]
+			s.pos += 2
+			switch esc {
+			case 't':
+				buf.WriteByte('\t')
+			case 'b':
+				buf.WriteByte('\b')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 'f':
+				buf.WriteByte('\f')
+			case '"', '\'', '\\':
+				buf.WriteByte(esc)
+			case 'u', 'U':
+				n := 4
+				if esc == 'U' {
+					n = 8
+				}
+				if s.pos+n > len(s.line) {
+					return "", fmt.Errorf("truncated unicode escape at column %d", s.pos)
+				}
+				code, err := strconv.ParseUint(s.line[s.pos:s.pos+n], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(code)) {
+					return "", fmt.Errorf("invalid unicode escape at column %d", s.pos)
+				}
+				buf.WriteRune(rune(code))
+				s.pos += n
+			default:
+				return "", fmt.Errorf("invalid escape \\%c in literal at column %d", esc, s.pos-1)
+			}
+		default:
+			buf.WriteByte(c)
+			s.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated literal at column %d", start+1)
+}
+
+// parseNQuad parses an N-Quad line: subject, predicate, object, optional
+// label and facets, and the final dot.
+func parseNQuad(line string) (*dgoapi.NQuad, error) {
+	s := &rdfScanner{line: line}
+	nq := &dgoapi.NQuad{}
+	var err error
+
+	if nq.Subject, err = s.node(); err != nil {
+		return nil, fmt.Errorf("invalid subject: %s", err)
+	}
+	s.skipSpace()
+	if s.consume("*") {
+		nq.Predicate = "*"
+	} else if nq.Predicate, err = s.iri(); err != nil {
+		return nil, fmt.Errorf("invalid predicate: %s", err)
+	}
+	s.skipSpace()
+	if err = s.object(nq); err != nil {
+		return nil, fmt.Errorf("invalid object: %s", err)
+	}
+	s.skipSpace()
+	if s.peek() == '<' {
+		if nq.Label, err = s.iri(); err != nil {
+			return nil, fmt.Errorf("invalid label: %s", err)
+		}
+		s.skipSpace()
+	}
+	if s.peek() == '(' {
+		if nq.Facets, err = s.facets(); err != nil {
+			return nil, fmt.Errorf("invalid facets: %s", err)
+		}
+		s.skipSpace()
+	}
+	if !s.consume(".") {
+		return nil, fmt.Errorf("expected '.' at column %d", s.pos+1)
+	}
+	s.skipSpace()
+	if s.pos < len(s.line) && s.peek() != '#' {
+		return nil, fmt.Errorf("unexpected text after '.' at column %d", s.pos+1)
+	}
+	return nq, nil
+}
+
+// object reads the object of a quad: a node, a star or a literal with an
+// optional language tag or type.
+func (s *rdfScanner) object(nq *dgoapi.NQuad) error {
+	if s.consume("*") {
+		nq.ObjectValue = &dgoapi.Value{Val: &dgoapi.Value_DefaultVal{DefaultVal: "_STAR_ALL"}}
+		return nil
+	}
+	if s.peek() != '"' {
+		id, err := s.node()
+		nq.ObjectId = id
+		return err
+	}
+
+	lit, err := s.literal()
+	if err != nil {
+		return err
+	}
+	switch {
+	case s.consume("@"):
+		nq.Lang = s.until(" \t<(.")
+		if nq.Lang == "" {
+			return fmt.Errorf("empty language tag at column %d", s.pos)
+		}
+		nq.ObjectValue = &dgoapi.Value{Val: &dgoapi.Value_StrVal{StrVal: lit}}
+	case s.consume("^^"):
+		typ, err := s.iri()
+		if err != nil {
+			return err
+		}
+		nq.ObjectValue, err = typedValue(lit, typ)
+		return err
+	default:
+		nq.ObjectValue = &dgoapi.Value{Val: &dgoapi.Value_StrVal{StrVal: lit}}
+	}
+	return nil
+}
+
+// typedValue converts a typed literal to a quad value.
+func typedValue(lit, typ string) (*dgoapi.Value, error) {
+	if strings.HasPrefix(typ, xsPrefix) {
+		typ = "xs:" + strings.TrimPrefix(typ, xsPrefix)
+	}
+	switch typ {
+	case "xs:string":
+		return &dgoapi.Value{Val: &dgoapi.Value_StrVal{StrVal: lit}}, nil
+	case "xs:int", "xs:integer", "xs:positiveInteger":
+		i, err := strconv.ParseInt(lit, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", typ, lit)
+		}
+		return &dgoapi.Value{Val: &dgoapi.Value_IntVal{IntVal: i}}, nil
+	case "xs:boolean":
+		b, err := strconv.ParseBool(lit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", typ, lit)
+		}
+		return &dgoapi.Value{Val: &dgoapi.Value_BoolVal{BoolVal: b}}, nil
+	case "xs:double", "xs:float":
+		f, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", typ, lit)
+		}
+		return &dgoapi.Value{Val: &dgoapi.Value_DoubleVal{DoubleVal: f}}, nil
+	case "xs:password":
+		return &dgoapi.Value{Val: &dgoapi.Value_PasswordVal{PasswordVal: lit}}, nil
+	case "xs:base64Binary":
+		b, err := base64.StdEncoding.DecodeString(lit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", typ, lit)
+		}
+		return &dgoapi.Value{Val: &dgoapi.Value_BytesVal{BytesVal: b}}, nil
+	case "xs:dateTime", "xs:date":
+		t, err := parseRDFTime(lit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", typ, lit)
+		}
+		b, err := t.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return &dgoapi.Value{Val: &dgoapi.Value_DatetimeVal{DatetimeVal: b}}, nil
+	}
+	return nil, fmt.Errorf("unsupported type <%s>", typ)
+}
+
+// parseRDFTime parses the date and time formats accepted by dgraph.
+func parseRDFTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// facets reads the facets in parentheses: comma separated key=value pairs
+// with quoted string values, and unquoted numbers, booleans and datetimes.
+func (s *rdfScanner) facets() ([]*dgoapi.Facet, error) {
+	s.consume("(")
+	var facets []*dgoapi.Facet
+	for {
+		s.skipSpace()
+		if s.consume(")") {
+			return facets, nil
+		}
+		if len(facets) > 0 {
+			if !s.consume(",") {
+				return nil, fmt.Errorf("expected ',' or ')' at column %d", s.pos+1)
+			}
+			s.skipSpace()
+		}
+		key := strings.TrimSpace(s.until("=,)"))
+		if key == "" || !s.consume("=") {
+			return nil, fmt.Errorf("expected key=value at column %d", s.pos+1)
+		}
+		s.skipSpace()
+		var f *dgoapi.Facet
+		if s.peek() == '"' {
+			val, err := s.literal()
+			if err != nil {
+				return nil, err
+			}
+			f = &dgoapi.Facet{Key: key, Value: []byte(val), ValType: dgoapi.Facet_STRING, Tokens: []string{val}}
+		} else {
+			var err error
+			if f, err = parseFacetValue(key, strings.TrimSpace(s.until(",)"))); err != nil {
+				return nil, err
+			}
+		}
+		facets = append(facets, f)
+	}
+}
+
+// parseFacetValue converts an unquoted facet value to a facet.
+func parseFacetValue(key, val string) (*dgoapi.Facet, error) {
+	if val == "true" || val == "false" {
+		return CreateFacetBool(key, val == "true"), nil
+	}
+	if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return CreateFacetInt(key, i), nil
+	}
+	if f, err := strconv.ParseFloat(val, 64); err == nil {
+		return CreateFacetFloat(key, f), nil
+	}
+	if _, err := parseRDFTime(val); err == nil {
+		return CreateFacetDatetime(key, val), nil
+	}
+	return nil, fmt.Errorf("invalid value %q of facet %s", val, key)
+}
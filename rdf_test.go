@@ -0,0 +1,148 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+)
+
+func datetimeValue(t *testing.T, tm time.Time) *dgoapi.Value {
+	b, err := tm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dgoapi.Value{Val: &dgoapi.Value_DatetimeVal{DatetimeVal: b}}
+}
+
+func TestRDFRoundTrip(t *testing.T) {
+	q := NewQuads()
+	id := q.AddUpsertQuery("name", "a", "Node0")
+	q.SetQuadStrUpsert(id, "name", "a", CreateFacetString("source", `say "hi"`), CreateFacetInt("weight", -3))
+	q.SetQuadStr("_:b", "description", "line 1\nline 2\ttabbed \\ \u0001")
+	q.SetQuadInt64("_:b", "count", 42, CreateFacetFloat("ratio", 2), CreateFacetBool("ok", true))
+	q.SetQuadBool("_:b", "active", false, CreateFacetDatetime("since", "2020-08-01T10:00:00Z"))
+	q.SetQuadRel("_:b", "LINK0", "0x2a", CreateFacetFloat("score", 0.25))
+	q.SetQuadRelUpsertTo("_:b", "LINK1", id)
+	q.setQuads = append(q.setQuads,
+		&dgoapi.NQuad{Subject: "_:b", Predicate: "name", Lang: "fr", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_StrVal{StrVal: "bé"}}},
+		&dgoapi.NQuad{Subject: "_:b", Predicate: "height", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_DoubleVal{DoubleVal: 1.5e-3}}},
+		&dgoapi.NQuad{Subject: "_:b", Predicate: "created", ObjectValue: datetimeValue(t, time.Date(2020, 8, 1, 10, 0, 0, 5, time.UTC))},
+		&dgoapi.NQuad{Subject: "_:b", Predicate: "secret", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_PasswordVal{PasswordVal: "pw"}}},
+		&dgoapi.NQuad{Subject: "_:b", Predicate: "blob", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_BytesVal{BytesVal: []byte{0, 1, 255}}}},
+		&dgoapi.NQuad{Subject: "_:b", Predicate: "tagged", ObjectId: "_:c", Label: "graph"},
+	)
+	q.DelQuadProp("0x1", "name")
+	q.DelQuadRel("0x1", "LINK0", "0x2")
+	q.DelQuadNodeUpsert(id)
+
+	set, err := q.SetRDF()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	del, err := q.DelRDF()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	parsed := NewQuads()
+	if err := parsed.LoadRDF(set, del); err != nil {
+		t.Fatalf("unable to parse:\n%s%s\n%s", set, del, err)
+	}
+	if !reflect.DeepEqual(parsed.setQuads, q.setQuads) {
+		t.Errorf("set quads differ after a round trip:\n%s\n%v", set, parsed.setQuads)
+	}
+	if !reflect.DeepEqual(parsed.delQuads, q.delQuads) {
+		t.Errorf("del quads differ after a round trip:\n%s\n%v", del, parsed.delQuads)
+	}
+
+	// Uid values come back as edges, and dates as datetimes.
+	when := datetimeValue(t, time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC))
+	q = NewQuads()
+	q.setQuads = append(q.setQuads,
+		&dgoapi.NQuad{Subject: "_:b", Predicate: "LINK0", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_UidVal{UidVal: 42}}},
+		&dgoapi.NQuad{Subject: "_:b", Predicate: "day", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_DateVal{DateVal: when.GetDatetimeVal()}}},
+	)
+	if set, err = q.SetRDF(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	parsed = NewQuads()
+	if err := parsed.LoadRDF(set, ""); err != nil {
+		t.Fatalf("unable to parse:\n%s\n%s", set, err)
+	}
+	want := []*dgoapi.NQuad{
+		{Subject: "_:b", Predicate: "LINK0", ObjectId: "0x2a"},
+		{Subject: "_:b", Predicate: "day", ObjectValue: when},
+	}
+	if !reflect.DeepEqual(parsed.setQuads, want) {
+		t.Errorf("expected %v after a round trip of:\n%s\ngot %v", want, set, parsed.setQuads)
+	}
+
+	q.setQuads = append(q.setQuads, &dgoapi.NQuad{Subject: "_:b", Predicate: "loc", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_GeoVal{GeoVal: []byte{1}}}})
+	if _, err := q.SetRDF(); err == nil {
+		t.Error("expected an error for a geo value")
+	}
+}
+
+func TestFormatNQuad(t *testing.T) {
+	q := NewQuads()
+	q.SetQuadInt64("_:a", "count", 3, CreateFacetInt("w", 2))
+	q.SetQuadBool("_:a", "ok", true)
+	q.setQuads = append(q.setQuads, &dgoapi.NQuad{Subject: "_:a", Predicate: "name", ObjectValue: &dgoapi.Value{Val: &dgoapi.Value_StrVal{StrVal: `a "b"`}}})
+	q.DelQuadNodeUpsert("upsert_id_0")
+	want := []string{
+		`_:a <count> "3"^^<xs:int> (w=2) .`,
+		`_:a <ok> "true"^^<xs:boolean> .`,
+		`_:a <name> "a \"b\"" .`,
+		`uid(upsert_id_0) * * .`,
+	}
+	for i, nq := range append(q.setQuads, q.delQuads...) {
+		got, err := formatNQuad(nq)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != want[i] {
+			t.Errorf("expected %s, got %s", want[i], got)
+		}
+	}
+}
+
+func TestParseRDF(t *testing.T) {
+	rdf := `
+# comment
+<0x1> <name> "Alice"^^<http://www.w3.org/2001/XMLSchema#string> .
+_:x <age> "30"^^<xs:integer> . # trailing comment
+_:x <friend> <0x1> (close=true, since=2006-01-02T15:04:05) .
+`
+	nqs, err := ParseRDF(strings.NewReader(rdf))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nqs) != 3 {
+		t.Fatalf("expected 3 quads, got %d", len(nqs))
+	}
+	if nqs[0].Subject != "0x1" || nqs[0].ObjectValue.GetStrVal() != "Alice" {
+		t.Errorf("unexpected quad %v", nqs[0])
+	}
+	if nqs[1].ObjectValue.GetIntVal() != 30 {
+		t.Errorf("unexpected quad %v", nqs[1])
+	}
+	if nqs[2].ObjectId != "0x1" || len(nqs[2].Facets) != 2 || nqs[2].Facets[1].ValType != dgoapi.Facet_DATETIME {
+		t.Errorf("unexpected quad %v", nqs[2])
+	}
+
+	for _, bad := range []string{
+		`_:x <name> "unterminated .`,
+		`_:x <name> "a"`,
+		`_:x name "a" .`,
+		`_:x <age> "x"^^<xs:int> .`,
+		`_:x <name> "a" (k=) .`,
+		`_:x <name> "a\q" .`,
+		`_:x <name> "a" . extra`,
+	} {
+		if _, err := ParseRDF(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error parsing %s", bad)
+		}
+	}
+}
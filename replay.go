@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+)
+
+// requestRecord is a mutation request sent to dgraph, as recorded in a JSON
+// Lines recording. The quads are kept in the encoding they were sent in: RDF
+// N-Quads in the set and del fields, or JSON in the set_json and del_json
+// fields.
+type requestRecord struct {
+	OffsetMs float64         `json:"offset_ms"` // time since the recording started
+	Query    string          `json:"query,omitempty"`
+	Cond     string          `json:"cond,omitempty"`
+	Set      string          `json:"set,omitempty"`
+	Del      string          `json:"del,omitempty"`
+	SetJSON  json.RawMessage `json:"set_json,omitempty"`
+	DelJSON  json.RawMessage `json:"del_json,omitempty"`
+}
+
+// newRequestRecord returns the record of a request with a single mutation.
+func newRequestRecord(req *dgoapi.Request, offset time.Duration) (requestRecord, error) {
+	rec := requestRecord{OffsetMs: durationMs(offset), Query: req.Query}
+	if len(req.Mutations) != 1 {
+		return rec, fmt.Errorf("unable to record a request with %d mutations", len(req.Mutations))
+	}
+	mu := req.Mutations[0]
+	rec.Cond = mu.Cond
+	var err error
+	if rec.Set, err = nquadsRDF(mu.Set); err != nil {
+		return rec, err
+	}
+	if rec.Del, err = nquadsRDF(mu.Del); err != nil {
+		return rec, err
+	}
+	rec.Set += string(mu.SetNquads)
+	rec.Del += string(mu.DelNquads)
+	rec.SetJSON = mu.SetJson
+	rec.DelJSON = mu.DeleteJson
+	return rec, nil
+}
+
+// Offset returns the time since the start of the recording at which the
+// request was sent.
+func (rec requestRecord) Offset() time.Duration {
+	return time.Duration(rec.OffsetMs * float64(time.Millisecond))
+}
+
+// Request returns the dgraph request to send the recorded mutation again,
+// with the quads as RDF or JSON text for dgraph to parse.
+func (rec requestRecord) Request() *dgoapi.Request {
+	mu := &dgoapi.Mutation{
+		Cond:       rec.Cond,
+		SetNquads:  []byte(rec.Set),
+		DelNquads:  []byte(rec.Del),
+		SetJson:    rec.SetJSON,
+		DeleteJson: rec.DelJSON,
+		CommitNow:  true,
+	}
+	return &dgoapi.Request{Query: rec.Query, Mutations: []*dgoapi.Mutation{mu}, CommitNow: true}
+}
+
+// requestRecorder writes the mutation requests sent to dgraph to a JSON Lines
+// recording, one record per line. It is safe for concurrent use.
+type requestRecorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	bw    *bufio.Writer
+	start time.Time
+	count int64
+	err   error // first write error
+}
+
+// createRecorder creates the recording at path.
+func createRecorder(path string) (*requestRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create recording: %s", err)
+	}
+	return &requestRecorder{f: f, bw: bufio.NewWriter(f), start: time.Now()}, nil
+}
+
+// Record records a request sent now.
+func (rr *requestRecorder) Record(req *dgoapi.Request) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if rr.err != nil {
+		return
+	}
+	rec, err := newRequestRecord(req, time.Since(rr.start))
+	if err != nil {
+		rr.err = err
+		return
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		rr.err = err
+		return
+	}
+	b = append(b, '\n')
+	if _, rr.err = rr.bw.Write(b); rr.err == nil {
+		rr.count++
+	}
+}
+
+// Count returns the number of requests recorded.
+func (rr *requestRecorder) Count() int64 {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return rr.count
+}
+
+// Close flushes and closes the recording, returning the first error
+// encountered while writing it.
+func (rr *requestRecorder) Close() error {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if err := rr.bw.Flush(); rr.err == nil {
+		rr.err = err
+	}
+	if err := rr.f.Close(); rr.err == nil {
+		rr.err = err
+	}
+	if rr.err != nil {
+		return fmt.Errorf("unable to write recording: %s", rr.err)
+	}
+	return nil
+}
+
+// readRecording reads the requests of a recording.
+func readRecording(path string) ([]requestRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open recording: %s", err)
+	}
+	defer f.Close()
+
+	var recs []requestRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxSendMsgSize)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec requestRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("unable to read recording line %d: %s", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read recording: %s", err)
+	}
+	return recs, nil
+}
+
+// replayWorkload sends the requests of a recording to dgraph again. The
+// requests are dealt out to the workers in turn, and each is sent at its
+// recorded offset divided by the speed, or as soon as possible if the speed
+// is 0.
+type replayWorkload struct {
+	dgc     *GraphConnection
+	path    string
+	recs    []requestRecord
+	speed   float64
+	workers int
+
+	once  sync.Once
+	start time.Time
+}
+
+func newReplayWorkload(dgc *GraphConnection, path string, recs []requestRecord, speed float64, workers int) *replayWorkload {
+	if workers < 1 {
+		workers = 1
+	}
+	return &replayWorkload{dgc: dgc, path: path, recs: recs, speed: speed, workers: workers}
+}
+
+func (wl *replayWorkload) Header() string {
+	pace := "as fast as possible"
+	if wl.speed > 0 {
+		pace = fmt.Sprintf("%gx the recorded pace", wl.speed)
+	}
+	return fmt.Sprintf("Replay of %d requests from %s, %s", len(wl.recs), wl.path, pace)
+}
+
+// Due returns the time the request of a round is sent at, which the runner
+// waits for, unless the requests are sent as fast as possible.
+func (wl *replayWorkload) Due(w *worker, round int) (time.Time, bool) {
+	if wl.speed <= 0 {
+		return time.Time{}, false
+	}
+	wl.once.Do(func() { wl.start = time.Now() })
+	rec := wl.recs[round*wl.workers+w.id]
+	return wl.start.Add(time.Duration(float64(rec.Offset()) / wl.speed)), true
+}
+
+func (wl *replayWorkload) Do(ctx context.Context, w *worker, round int) opResult {
+	rec := wl.recs[round*wl.workers+w.id]
+	startTime := time.Now()
+	err := wl.dgc.Replay(ctx, rec.Request())
+	return opResult{op: "replay", latency: time.Since(startTime), err: err}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	fs := startFakeServer(t)
+	gc := fs.connect(t, fs.connOptions())
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	rr, err := createRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gc.RecordTo(rr)
+
+	cfg := testConfig{nodeTypeCount: 2, nodePredCount: 1, predStringLen: 8, rounds: 4, workers: 2}
+	rc := runContexts{stop: context.Background(), ops: context.Background()}
+	if err := newRunner(newWriteWorkload(gc, newFullyConnectedGenerator(cfg)), cfg).Run(rc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := rr.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	recs, err := readRecording(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(recs) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(recs))
+	}
+	for i, rec := range recs {
+		if i > 0 && rec.OffsetMs < recs[i-1].OffsetMs {
+			t.Errorf("expected increasing offsets, got %g after %g", rec.OffsetMs, recs[i-1].OffsetMs)
+		}
+		if !strings.Contains(rec.Set, " <name> ") {
+			t.Errorf("expected quads to set, got %q", rec.Set)
+		}
+	}
+
+	before := len(fs.Requests())
+	replayCfg := testConfig{rounds: len(recs), workers: 2}
+	wl := newReplayWorkload(gc, path, recs, 0, replayCfg.workers)
+	if err := newRunner(wl, replayCfg).Run(rc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reqs := fs.Requests()[before:]
+	if len(reqs) != 4 {
+		t.Fatalf("expected 4 replayed requests, got %d", len(reqs))
+	}
+	replayed := make(map[string]bool)
+	for _, req := range reqs {
+		replayed[string(req.Mutations[0].SetNquads)] = true
+	}
+	for _, rec := range recs {
+		if !replayed[rec.Set] {
+			t.Errorf("expected request %q to be replayed", rec.Set)
+		}
+	}
+}
+
+func TestReplayPace(t *testing.T) {
+	fs := startFakeServer(t)
+	gc := fs.connect(t, fs.connOptions())
+	recs := []requestRecord{
+		{OffsetMs: 0, Set: "_:a <name> \"a\" .\n"},
+		{OffsetMs: 100, Set: "_:b <name> \"b\" .\n"},
+	}
+
+	cfg := testConfig{rounds: len(recs), workers: 1}
+	rc := runContexts{stop: context.Background(), ops: context.Background()}
+	startTime := time.Now()
+	if err := newRunner(newReplayWorkload(gc, "test", recs, 2, 1), cfg).Run(rc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if elapsed := time.Since(startTime); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected the replay to take about 50ms at twice the pace, took %s", elapsed)
+	}
+}
+
+func TestReplayPaceStops(t *testing.T) {
+	fs := startFakeServer(t)
+	gc := fs.connect(t, fs.connOptions())
+	recs := []requestRecord{
+		{OffsetMs: 0, Set: "_:a <name> \"a\" .\n"},
+		{OffsetMs: 10000, Set: "_:b <name> \"b\" .\n"},
+	}
+
+	cfg := testConfig{rounds: len(recs), workers: 1}
+	stop, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rc := runContexts{stop: stop, ops: context.Background()}
+	startTime := time.Now()
+	if err := newRunner(newReplayWorkload(gc, "test", recs, 1, 1), cfg).Run(rc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Errorf("expected the replay to stop waiting when the run stops, took %s", elapsed)
+	}
+	if n := len(fs.Requests()); n != 1 {
+		t.Errorf("expected 1 request sent before the run stopped, got %d", n)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Formats of the results file.
+const (
+	resultsJSONL = "jsonl"
+	resultsCSV   = "csv"
+)
+
+// param is a named run parameter recorded in the results file.
+type param struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// roundRecord is the outcome of a worker round.
+type roundRecord struct {
+	Worker    int     `json:"worker"`
+	Round     int     `json:"round"`
+	Op        string  `json:"op"`
+	Quads     int     `json:"quads"`
+	LatencyMs float64 `json:"latency_ms"`
+	Category  string  `json:"category,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// retryRecord is a dgraph operation attempt that failed and was retried.
+type retryRecord struct {
+	Op       string `json:"op"`
+	Category string `json:"category"`
+	Attempt  int    `json:"attempt"`
+	Error    string `json:"error"`
+}
+
+// opSummary summarizes the results of one type of operation.
+type opSummary struct {
+	Op       string  `json:"op"`
+	Count    int64   `json:"count"`
+	Errors   int64   `json:"errors"`
+	MinMs    float64 `json:"min_ms"`
+	MeanMs   float64 `json:"mean_ms"`
+	StdDevMs float64 `json:"stddev_ms"`
+	P50Ms    float64 `json:"p50_ms"`
+	P90Ms    float64 `json:"p90_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	P999Ms   float64 `json:"p99_9_ms"`
+	MaxMs    float64 `json:"max_ms"`
+}
+
+// stageSummary summarizes the rounds started in a stage of a load profile.
+type stageSummary struct {
+	Stage        int         `json:"stage"`
+	Workers      int         `json:"workers"`
+	Rate         float64     `json:"rate_per_sec,omitempty"`
+	Rounds       int64       `json:"rounds"`
+	Quads        int64       `json:"quads"`
+	ElapsedMs    float64     `json:"elapsed_ms"`
+	RoundsPerSec float64     `json:"rounds_per_sec"`
+	QuadsPerSec  float64     `json:"quads_per_sec"`
+	Ops          []opSummary `json:"ops"`
+}
+
+// runSummary summarizes a run.
+type runSummary struct {
+	Rounds       int64          `json:"rounds"`
+	Quads        int64          `json:"quads"`
+	Workers      int            `json:"workers"`
+	ElapsedMs    float64        `json:"elapsed_ms"`
+	RoundsPerSec float64        `json:"rounds_per_sec"`
+	QuadsPerSec  float64        `json:"quads_per_sec"`
+	Stopped      bool           `json:"stopped_early"`
+	Sanitize     string         `json:"sanitize_policy"`
+	Values       int64          `json:"sanitized_values"`
+	Altered      int64          `json:"altered_values"`         // stripped, escaped or rejected per the policy
+	Rate         float64        `json:"rate_per_sec,omitempty"` // open-loop rate, if any
+	Missed       int64          `json:"missed_schedule"`        // open-loop rounds started late
+	Ops          []opSummary    `json:"ops"`
+	Stages       []stageSummary `json:"stages,omitempty"` // per stage of the load profile, if any
+}
+
+func newOpSummary(op string, s *opStats) opSummary {
+	return opSummary{
+		Op:       op,
+		Count:    s.count,
+		Errors:   s.errors,
+		MinMs:    durationMs(s.latency.Min()),
+		MeanMs:   durationMs(s.latency.Mean()),
+		StdDevMs: durationMs(s.latency.StdDev()),
+		P50Ms:    durationMs(s.latency.Percentile(50)),
+		P90Ms:    durationMs(s.latency.Percentile(90)),
+		P99Ms:    durationMs(s.latency.Percentile(99)),
+		P999Ms:   durationMs(s.latency.Percentile(99.9)),
+		MaxMs:    durationMs(s.latency.Max()),
+	}
+}
+
+// resultsFile writes the machine-readable results of a run. In JSON Lines
+// format every record is an object with a "type" field (params, round,
+// error, retry, summary) and the milliseconds elapsed since the file was
+// created. In CSV format the round, error and retry records are rows, and the
+// params and summary are "#" comment lines. It is safe for concurrent use.
+type resultsFile struct {
+	mu      sync.Mutex
+	f       *os.File
+	bw      *bufio.Writer
+	csv     *csv.Writer
+	format  string
+	start   time.Time
+	params  bool          // whether the params, and the CSV header, were written
+	retries []retryRecord // retries held until the params are written
+	err     error         // first write error
+}
+
+var resultsCSVHeader = []string{"type", "elapsed_ms", "worker", "round", "op", "quads", "latency_ms", "attempt", "category", "error"}
+
+// createResultsFile creates the results file at path in the given format.
+func createResultsFile(path, format string) (*resultsFile, error) {
+	if format != resultsJSONL && format != resultsCSV {
+		return nil, fmt.Errorf("unknown results format %q", format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create results file: %s", err)
+	}
+	rf := &resultsFile{
+		f:      f,
+		bw:     bufio.NewWriter(f),
+		format: format,
+		start:  time.Now(),
+	}
+	if format == resultsCSV {
+		rf.csv = csv.NewWriter(rf.bw)
+	}
+	return rf, nil
+}
+
+func (rf *resultsFile) elapsedMs() float64 {
+	return durationMs(time.Since(rf.start))
+}
+
+func formatMs(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 3, 64)
+}
+
+// writeJSON writes a JSON Lines record. The caller must hold rf.mu.
+func (rf *resultsFile) writeJSON(recordType string, fields interface{}) {
+	if rf.err != nil {
+		return
+	}
+	rec := struct {
+		Type      string      `json:"type"`
+		ElapsedMs float64     `json:"elapsed_ms"`
+		Data      interface{} `json:"data"`
+	}{recordType, rf.elapsedMs(), fields}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		rf.err = err
+		return
+	}
+	b = append(b, '\n')
+	_, rf.err = rf.bw.Write(b)
+}
+
+// writeCSV writes a CSV row. The caller must hold rf.mu.
+func (rf *resultsFile) writeCSV(row []string) {
+	if rf.err != nil {
+		return
+	}
+	rf.err = rf.csv.Write(row)
+}
+
+// writeComment writes a CSV comment line. The caller must hold rf.mu.
+func (rf *resultsFile) writeComment(format string, args ...interface{}) {
+	if rf.err != nil {
+		return
+	}
+	rf.csv.Flush()
+	_, rf.err = fmt.Fprintf(rf.bw, "# "+format+"\n", args...)
+}
+
+// Params records the parameters of the run.
+func (rf *resultsFile) Params(params []param) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.format == resultsJSONL {
+		rf.writeJSON("params", params)
+	} else {
+		for _, p := range params {
+			rf.writeComment("%s: %s", p.Name, p.Value)
+		}
+		rf.writeCSV(resultsCSVHeader)
+	}
+	rf.writeHeldRetries()
+}
+
+// writeHeldRetries marks the params as written and writes the retries held
+// until then, such as those of the schema alter. The caller must hold rf.mu.
+func (rf *resultsFile) writeHeldRetries() {
+	rf.params = true
+	for _, rec := range rf.retries {
+		rf.writeRetry(rec)
+	}
+	rf.retries = nil
+}
+
+// Round records the outcome of a worker round.
+func (rf *resultsFile) Round(rec roundRecord) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	recordType := "round"
+	if rec.Error != "" {
+		recordType = "error"
+	}
+	if rf.format == resultsJSONL {
+		rf.writeJSON(recordType, rec)
+		return
+	}
+	rf.writeCSV([]string{recordType, formatMs(rf.elapsedMs()), strconv.Itoa(rec.Worker), strconv.Itoa(rec.Round), rec.Op,
+		strconv.Itoa(rec.Quads), formatMs(rec.LatencyMs), "", rec.Category, rec.Error})
+}
+
+// Retry records a retried dgraph operation. The retries before the params are
+// written are held until then.
+func (rf *resultsFile) Retry(rec retryRecord) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if !rf.params {
+		rf.retries = append(rf.retries, rec)
+		return
+	}
+	rf.writeRetry(rec)
+}
+
+// writeRetry writes a retry record. The caller must hold rf.mu.
+func (rf *resultsFile) writeRetry(rec retryRecord) {
+	if rf.format == resultsJSONL {
+		rf.writeJSON("retry", rec)
+		return
+	}
+	rf.writeCSV([]string{"retry", formatMs(rf.elapsedMs()), "", "", rec.Op, "", "", strconv.Itoa(rec.Attempt), rec.Category, rec.Error})
+}
+
+// Summary records the final summary of the run.
+func (rf *resultsFile) Summary(sum runSummary) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.format == resultsJSONL {
+		rf.writeJSON("summary", sum)
+		return
+	}
+	rf.writeComment("summary: rounds=%d quads=%d workers=%d elapsed_ms=%s rounds_per_sec=%.1f quads_per_sec=%.1f stopped_early=%t sanitize_policy=%s sanitized_values=%d altered_values=%d rate_per_sec=%g missed_schedule=%d",
+		sum.Rounds, sum.Quads, sum.Workers, formatMs(sum.ElapsedMs), sum.RoundsPerSec, sum.QuadsPerSec, sum.Stopped, sum.Sanitize, sum.Values, sum.Altered, sum.Rate, sum.Missed)
+	rf.writeOpComments("summary", sum.Ops)
+	for _, st := range sum.Stages {
+		rf.writeComment("summary stage %d: workers=%d rate_per_sec=%g rounds=%d quads=%d elapsed_ms=%s rounds_per_sec=%.1f quads_per_sec=%.1f",
+			st.Stage, st.Workers, st.Rate, st.Rounds, st.Quads, formatMs(st.ElapsedMs), st.RoundsPerSec, st.QuadsPerSec)
+		rf.writeOpComments(fmt.Sprintf("summary stage %d", st.Stage), st.Ops)
+	}
+}
+
+// writeOpComments writes the operation summaries as CSV comment lines. The
+// caller must hold rf.mu.
+func (rf *resultsFile) writeOpComments(prefix string, ops []opSummary) {
+	for _, o := range ops {
+		rf.writeComment("%s %s: count=%d errors=%d min_ms=%s mean_ms=%s stddev_ms=%s p50_ms=%s p90_ms=%s p99_ms=%s p99_9_ms=%s max_ms=%s",
+			prefix, o.Op, o.Count, o.Errors, formatMs(o.MinMs), formatMs(o.MeanMs), formatMs(o.StdDevMs),
+			formatMs(o.P50Ms), formatMs(o.P90Ms), formatMs(o.P99Ms), formatMs(o.P999Ms), formatMs(o.MaxMs))
+	}
+}
+
+// Close flushes and closes the results file, returning the first error
+// encountered while writing it.
+func (rf *resultsFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if !rf.params && len(rf.retries) > 0 {
+		// The run failed before writing the params, e.g. in the schema alter.
+		if rf.csv != nil {
+			rf.writeCSV(resultsCSVHeader)
+		}
+		rf.writeHeldRetries()
+	}
+	if rf.csv != nil {
+		rf.csv.Flush()
+		if rf.err == nil {
+			rf.err = rf.csv.Error()
+		}
+	}
+	if err := rf.bw.Flush(); rf.err == nil {
+		rf.err = err
+	}
+	if err := rf.f.Close(); rf.err == nil {
+		rf.err = err
+	}
+	if rf.err != nil {
+		return fmt.Errorf("unable to write results file: %s", rf.err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testResults holds the records written to the results file of every format.
+var testResults = struct {
+	params  []param
+	rounds  []roundRecord
+	retry   retryRecord
+	summary runSummary
+}{
+	params: []param{{Name: "command", Value: "unconnected"}, {Name: "seed", Value: "1"}},
+	rounds: []roundRecord{
+		{Worker: 0, Round: 0, Op: "write", Quads: 12, LatencyMs: 1.5},
+		{Worker: 1, Round: 3, Op: "query", LatencyMs: 2.25, Category: "permanent", Error: `bad "query", again`},
+	},
+	retry: retryRecord{Op: "mutate", Category: "aborted", Attempt: 1, Error: "Transaction has been aborted"},
+	summary: runSummary{
+		Rounds: 2, Quads: 12, Workers: 2, ElapsedMs: 10, RoundsPerSec: 200, QuadsPerSec: 1200,
+		Sanitize: sanitizeStrip, Values: 4, Ops: []opSummary{{Op: "write", Count: 1, MinMs: 1.5, MaxMs: 1.5}},
+		Stages: []stageSummary{{Stage: 0, Workers: 2, Rounds: 2, Quads: 12, ElapsedMs: 10, Ops: []opSummary{{Op: "write", Count: 1}}}},
+	},
+}
+
+// writeTestResults writes testResults to a new results file in the given
+// format and returns its path.
+func writeTestResults(t *testing.T, format string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "results."+format)
+	rf, err := createResultsFile(path, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf.Params(testResults.params)
+	for _, rec := range testResults.rounds {
+		rf.Round(rec)
+	}
+	rf.Retry(testResults.retry)
+	rf.Summary(testResults.summary)
+	if err := rf.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return path
+}
+
+// jsonRecord is a record of a JSON Lines results file.
+type jsonRecord struct {
+	Type      string          `json:"type"`
+	ElapsedMs float64         `json:"elapsed_ms"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func readJSONResults(t *testing.T, path string) []jsonRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []jsonRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec jsonRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid line %q: %s", sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestResultsJSONL(t *testing.T) {
+	recs := readJSONResults(t, writeTestResults(t, resultsJSONL))
+	types := make([]string, len(recs))
+	for i, rec := range recs {
+		types[i] = rec.Type
+	}
+	if want := []string{"params", "round", "error", "retry", "summary"}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("expected records %v, got %v", want, types)
+	}
+
+	var params []param
+	var rounds [2]roundRecord
+	var retry retryRecord
+	var summary runSummary
+	for i, v := range []interface{}{&params, &rounds[0], &rounds[1], &retry, &summary} {
+		if err := json.Unmarshal(recs[i].Data, v); err != nil {
+			t.Fatalf("%s: unexpected error: %s", recs[i].Type, err)
+		}
+	}
+	if !reflect.DeepEqual(params, testResults.params) {
+		t.Errorf("expected params %v, got %v", testResults.params, params)
+	}
+	if !reflect.DeepEqual(rounds[:], testResults.rounds) {
+		t.Errorf("expected rounds %v, got %v", testResults.rounds, rounds)
+	}
+	if retry != testResults.retry {
+		t.Errorf("expected retry %v, got %v", testResults.retry, retry)
+	}
+	if !reflect.DeepEqual(summary, testResults.summary) {
+		t.Errorf("expected summary %+v, got %+v", testResults.summary, summary)
+	}
+}
+
+func TestResultsCSV(t *testing.T) {
+	b, err := ioutil.ReadFile(writeTestResults(t, resultsCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var comments []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "# ") {
+			comments = append(comments, line)
+		}
+	}
+	for _, want := range []string{"# command: unconnected", "# seed: 1", "# summary: rounds=2 quads=12 workers=2", "# summary write: count=1", "# summary stage 0: workers=2"} {
+		found := false
+		for _, c := range comments {
+			found = found || strings.HasPrefix(c, want)
+		}
+		if !found {
+			t.Errorf("expected a comment starting with %q, got %v", want, comments)
+		}
+	}
+
+	r := csv.NewReader(strings.NewReader(string(b)))
+	r.Comment = '#'
+	rows, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rows) != 4 || !reflect.DeepEqual(rows[0], resultsCSVHeader) {
+		t.Fatalf("expected the header and 3 rows, got %v", rows)
+	}
+	want := [][]string{
+		{"round", "0", "0", "write", "12", "1.500", "", "", ""},
+		{"error", "1", "3", "query", "0", "2.250", "", "permanent", `bad "query", again`},
+		{"retry", "", "", "mutate", "", "", "1", "aborted", "Transaction has been aborted"},
+	}
+	for i, row := range rows[1:] {
+		// Skip the elapsed time, which varies.
+		got := append([]string{row[0]}, row[2:]...)
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("row %d: expected %q, got %q", i, want[i], got)
+		}
+	}
+}
+
+func TestResultsSchemaRetries(t *testing.T) {
+	for _, format := range []string{resultsJSONL, resultsCSV} {
+		fs := startFakeServer(t)
+		fs.failNext("Alter", status.Error(codes.Unavailable, "connection closed"))
+		gc := fs.connect(t, fs.connOptions())
+
+		path := filepath.Join(t.TempDir(), "results."+format)
+		rf, err := createResultsFile(path, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gc.OnRetry(func(op string, category ErrorCategory, attempt int, err error) {
+			rf.Retry(retryRecord{Op: op, Category: string(category), Attempt: attempt, Error: err.Error()})
+		})
+		// The schema is loaded before the runner writes the params.
+		if err := gc.LoadSchema(context.Background(), Schema("name: string .")); err != nil {
+			t.Fatalf("%s: unexpected error: %s", format, err)
+		}
+		rf.Params(testResults.params)
+		rf.Round(testResults.rounds[0])
+		rf.Summary(testResults.summary)
+		if err := rf.Close(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", format, err)
+		}
+
+		if format == resultsJSONL {
+			recs := readJSONResults(t, path)
+			types := make([]string, len(recs))
+			for i, rec := range recs {
+				types[i] = rec.Type
+			}
+			if want := []string{"params", "retry", "round", "summary"}; !reflect.DeepEqual(types, want) {
+				t.Fatalf("%s: expected records %v, got %v", format, want, types)
+			}
+			var retry retryRecord
+			if err := json.Unmarshal(recs[1].Data, &retry); err != nil {
+				t.Fatal(err)
+			}
+			if retry.Op != "alter" || retry.Category != string(ErrUnavailable) || retry.Attempt != 1 {
+				t.Errorf("%s: expected a retried alter, got %+v", format, retry)
+			}
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := csv.NewReader(f)
+		r.Comment = '#'
+		rows, err := r.ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", format, err)
+		}
+		if len(rows) != 3 || !reflect.DeepEqual(rows[0], resultsCSVHeader) {
+			t.Fatalf("%s: expected the header then 2 rows, got %v", format, rows)
+		}
+		if rows[1][0] != "retry" || rows[1][4] != "alter" || rows[1][8] != string(ErrUnavailable) || rows[2][0] != "round" {
+			t.Errorf("%s: expected the alter retry then the round, got %v", format, rows[1:])
+		}
+	}
+}
+
+func TestResultsRetriesWithoutParams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	rf, err := createResultsFile(path, resultsCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf.Retry(testResults.retry)
+	if err := rf.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(b))).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rows) != 2 || !reflect.DeepEqual(rows[0], resultsCSVHeader) || rows[1][0] != "retry" {
+		t.Errorf("expected the retries of a failed run after the header, got %v", rows)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy sets how failed dgraph operations are retried.
+type RetryPolicy struct {
+	InitialDelay time.Duration // delay before the first retry
+	Multiplier   float64       // factor applied to the delay after each retry
+	MaxDelay     time.Duration // cap on the delay between retries; 0 for no cap
+	Jitter       float64       // fraction of the delay randomly added or removed, in [0, 1]
+	MaxAttempts  int           // total attempts including the first; 0 for no limit
+	MaxElapsed   time.Duration // time after which no retry is started; 0 for no limit
+}
+
+// DefaultRetryPolicy is the retry policy used when none is configured.
+var DefaultRetryPolicy = RetryPolicy{
+	InitialDelay: dgTimeout,
+	Multiplier:   2,
+	MaxDelay:     5 * time.Minute,
+	MaxAttempts:  dgMaxRetries + 1,
+}
+
+// Delay returns the delay before the given retry, numbered from 1.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if jitter := math.Min(p.Jitter, 1); jitter > 0 {
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+	if delay >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
+
+// Allows returns true if a retry may be started after the given number of
+// attempts, elapsed time since the first attempt, and delay before the retry.
+func (p RetryPolicy) Allows(attempts int, elapsed, delay time.Duration) bool {
+	if p.MaxAttempts > 0 && attempts >= p.MaxAttempts {
+		return false
+	}
+	if p.MaxElapsed > 0 && elapsed+delay > p.MaxElapsed {
+		return false
+	}
+	return true
+}
+
+// sleepContext waits for d, returning early with the context error if ctx is
+// done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		retry  int
+		want   time.Duration
+	}{
+		{"first retry", RetryPolicy{InitialDelay: time.Second, Multiplier: 2}, 1, time.Second},
+		{"multiplied", RetryPolicy{InitialDelay: time.Second, Multiplier: 2}, 4, 8 * time.Second},
+		{"multiplier below 1", RetryPolicy{InitialDelay: time.Second, Multiplier: 0.5}, 3, time.Second},
+		{"capped", RetryPolicy{InitialDelay: time.Second, Multiplier: 2, MaxDelay: 5 * time.Second}, 4, 5 * time.Second},
+		{"no overflow", RetryPolicy{InitialDelay: time.Second, Multiplier: 10}, 100, time.Duration(1<<63 - 1)},
+		{"default", DefaultRetryPolicy, 3, 4 * dgTimeout},
+		{"default capped", DefaultRetryPolicy, 10, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Delay(tt.retry); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+
+	p := RetryPolicy{InitialDelay: time.Second, Multiplier: 2, MaxDelay: 4 * time.Second, Jitter: 0.25}
+	var below, above bool
+	for i := 0; i < 1000; i++ {
+		d := p.Delay(5) // capped at 4s before the jitter
+		if d < 3*time.Second || d > 5*time.Second {
+			t.Fatalf("expected a delay within 25%% of 4s, got %s", d)
+		}
+		below = below || d < 4*time.Second
+		above = above || d > 4*time.Second
+	}
+	if !below || !above {
+		t.Errorf("expected the jitter to both shorten and lengthen the delay")
+	}
+}
+
+func TestRetryPolicyAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempts int
+		elapsed  time.Duration
+		delay    time.Duration
+		want     bool
+	}{
+		{"default 10 retries", DefaultRetryPolicy, 10, 0, 0, true},
+		{"default 11 attempts", DefaultRetryPolicy, 11, 0, 0, false},
+		{"no limit", RetryPolicy{}, 1000, time.Hour, time.Hour, true},
+		{"under max elapsed", RetryPolicy{MaxElapsed: time.Minute}, 3, 30 * time.Second, 30 * time.Second, true},
+		{"over max elapsed", RetryPolicy{MaxElapsed: time.Minute}, 3, 30 * time.Second, 31 * time.Second, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Allows(tt.attempts, tt.elapsed, tt.delay); got != tt.want {
+			t.Errorf("%s: expected %t, got %t", tt.name, tt.want, got)
+		}
+	}
+	if DefaultRetryPolicy.MaxAttempts != 11 {
+		t.Errorf("expected 11 attempts by default, as before the retry policy, got %d", DefaultRetryPolicy.MaxAttempts)
+	}
+}
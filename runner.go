@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Workload performs the operations of a test, one per worker round.
+type Workload interface {
+	// Header returns the description printed at the start of the test.
+	Header() string
+	// Do performs a round of a worker.
+	Do(ctx context.Context, w *worker, round int) opResult
+}
+
+// pacedWorkload is a workload whose rounds are due at set times. The runner
+// waits for them until the run stops.
+type pacedWorkload interface {
+	Workload
+	// Due returns the time a round of a worker is due at, if any.
+	Due(w *worker, round int) (time.Time, bool)
+}
+
+// worker holds the state a worker keeps between its rounds.
+type worker struct {
+	id    int
+	quads *Quads
+	rng   *rand.Rand // the worker's stream of the run seed
+}
+
+func newWorker(id int, seed int64) *worker {
+	return &worker{id: id, quads: NewQuads(), rng: workerRand(seed, id)}
+}
+
+// workerRand returns the random number generator of a worker, seeded from
+// the run seed so that the same seed gives every worker the same stream, and
+// distinct workers and seeds unrelated streams.
+func workerRand(seed int64, id int) *rand.Rand {
+	// splitmix64 finalizer of the seed and worker
+	z := uint64(seed) + uint64(id+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return rand.New(rand.NewSource(int64(z)))
+}
+
+// opResult describes an operation performed in a round.
+type opResult struct {
+	op      string
+	quads   *Quads // the quads sent, if any
+	latency time.Duration
+	err     error
+}
+
+// runner performs the rounds of a workload with a pool of concurrent workers.
+type runner struct {
+	workload       Workload
+	workers        int
+	rounds         int
+	printQuads     bool
+	seed           int64            // seed of the workers' random data
+	schedule       *arrivalSchedule // open-loop start times of the rounds, if any
+	profile        *loadProfile     // stages of the load, if any
+	tolerateErrors bool             // count errors instead of stopping the run
+	results        *resultsFile     // optional machine-readable results
+	params         []param          // run parameters recorded in the results
+
+	mu          sync.Mutex // guards the output and the totals below
+	totalRounds int64
+	totalQuads  int64
+	stats       map[string]*opStats
+	missed      int64 // open-loop rounds started after their scheduled time
+	firstErr    error
+
+	stages       []*stageStats // stages of the profile reached
+	active       int           // workers active in the current stage
+	stageChanged chan struct{} // closed when the stage changes
+}
+
+// opStats accumulates the results of one type of operation.
+type opStats struct {
+	count   int64
+	errors  int64
+	latency Histogram
+}
+
+func newRunner(workload Workload, cfg testConfig) *runner {
+	workers := cfg.workers
+	if workers < 1 {
+		workers = 1
+	}
+	return &runner{
+		workload:   workload,
+		workers:    workers,
+		rounds:     cfg.rounds,
+		printQuads: cfg.printQuads,
+		stats:      make(map[string]*opStats),
+	}
+}
+
+// splitRounds returns the number of rounds performed by a worker when the
+// total rounds are split as evenly as possible across the workers.
+func splitRounds(rounds, workers, worker int) int {
+	n := rounds / workers
+	if worker < rounds%workers {
+		n++
+	}
+	return n
+}
+
+// Run starts the workers and waits for them to finish. The workers stop
+// starting new rounds once rc.stop is cancelled. Unless errors are tolerated,
+// the first worker error stops the remaining workers and is returned.
+func (r *runner) Run(rc runContexts) error {
+	ctx, cancel := context.WithCancel(rc.ops)
+	defer cancel()
+
+	stop, stopProfile := rc.stop, context.CancelFunc(func() {})
+	if r.profile != nil {
+		// Start enough workers for every stage, and stop once the last stage
+		// is over. This keeps the workers of a profile already resolved for
+		// the workload.
+		r.profile = r.profile.withWorkers(r.workers)
+		r.workers = r.profile.maxWorkers()
+		stop, stopProfile = context.WithCancel(rc.stop)
+		defer stopProfile()
+	}
+
+	fmt.Printf("# %s; %d workers; seed %d\n", r.workload.Header(), r.workers, r.seed)
+	if r.schedule != nil {
+		fmt.Printf("# Open loop at %s; latency measured from the scheduled start\n", r.schedule)
+	}
+	if r.profile != nil {
+		fmt.Printf("# Load profile: %s; %d stages; %s\n", r.profile.name, len(r.profile.stages), r.profile.Duration())
+	}
+	fmt.Println("worker,round,op,quad-count,time (ms)")
+	if r.results != nil {
+		params := append([]param{{Name: "workload", Value: r.workload.Header()}}, r.params...)
+		r.results.Params(params)
+	}
+
+	startTime := time.Now()
+	if r.schedule != nil {
+		r.schedule.Start(startTime)
+	}
+	var profileDone <-chan struct{}
+	if r.profile != nil {
+		profileDone = r.startProfile(stop, startTime, stopProfile)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < r.workers; w++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := r.runWorker(stop, ctx, newWorker(id, r.seed)); err != nil {
+				r.setErr(fmt.Errorf("worker %d: %s", id, err))
+				cancel()
+			}
+		}(w)
+	}
+	wg.Wait()
+	endTime := time.Now()
+	elapsed := endTime.Sub(startTime)
+	if profileDone != nil {
+		stopProfile()
+		<-profileDone
+		r.endStages(endTime)
+	}
+
+	stopped := rc.stop.Err() != nil
+	if stopped {
+		fmt.Println("# Run stopped early; partial results")
+	}
+
+	r.writeSummary(elapsed)
+	if r.results != nil {
+		r.results.Summary(r.summary(elapsed, stopped))
+	}
+	return r.firstErr
+}
+
+// sortedOps returns the types of the operations with stats, in name order.
+func sortedOps(stats map[string]*opStats) []string {
+	ops := make([]string, 0, len(stats))
+	for op := range stats {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+func (r *runner) summary(elapsed time.Duration, stopped bool) runSummary {
+	sum := runSummary{
+		Rounds:    r.totalRounds,
+		Quads:     r.totalQuads,
+		Workers:   r.workers,
+		ElapsedMs: durationMs(elapsed),
+		Stopped:   stopped,
+		Sanitize:  sanitizer.Policy(),
+		Missed:    r.missed,
+	}
+	if r.schedule != nil {
+		sum.Rate = r.schedule.rate
+	}
+	sum.Values, sum.Altered = sanitizer.Counts()
+	if secs := elapsed.Seconds(); secs > 0 {
+		sum.RoundsPerSec = float64(r.totalRounds) / secs
+		sum.QuadsPerSec = float64(r.totalQuads) / secs
+	}
+	for _, op := range sortedOps(r.stats) {
+		sum.Ops = append(sum.Ops, newOpSummary(op, r.stats[op]))
+	}
+	sum.Stages = r.stageSummaries()
+	return sum
+}
+
+func (r *runner) writeSummary(elapsed time.Duration) {
+	fmt.Printf("# Total: %d rounds; %d quads; %d workers; %d ms\n", r.totalRounds, r.totalQuads, r.workers, elapsed.Milliseconds())
+	for _, op := range sortedOps(r.stats) {
+		s := r.stats[op]
+		var errorRate float64
+		if s.count > 0 {
+			errorRate = 100 * float64(s.errors) / float64(s.count)
+		}
+		fmt.Printf("# %s: %d ops; %d errors (%.2f%%)\n", op, s.count, s.errors, errorRate)
+		s.latency.WriteLatency(os.Stdout, op)
+	}
+	r.writeStageSummaries()
+	if r.schedule != nil {
+		fmt.Printf("# Open loop: %d rounds missed their schedule\n", r.missed)
+	}
+	if values, _ := sanitizer.Counts(); values > 0 {
+		fmt.Printf("# %s\n", sanitizer.Summary())
+	}
+	writeThroughput(os.Stdout, r.totalRounds, r.totalQuads, elapsed)
+}
+
+func (r *runner) runWorker(stop, ctx context.Context, w *worker) error {
+	rounds := splitRounds(r.rounds, r.workers, w.id)
+	for round := 0; r.rounds <= 0 || round < rounds; round++ {
+		if stop.Err() != nil || ctx.Err() != nil {
+			return nil
+		}
+		if r.profile != nil && !r.waitActive(stop, ctx, w.id) {
+			return nil
+		}
+		stage := r.currentStage()
+		var scheduled time.Time
+		if r.schedule != nil {
+			scheduled = r.schedule.Next()
+			if time.Since(scheduled) > scheduleSlack {
+				r.missSchedule()
+			} else if !waitUntil(stop, ctx, scheduled) {
+				return nil
+			}
+		}
+		if pw, ok := r.workload.(pacedWorkload); ok {
+			if due, ok := pw.Due(w, round); ok && !waitUntil(stop, ctx, due) {
+				return nil
+			}
+		}
+		res := r.workload.Do(ctx, w, round)
+		if r.schedule != nil {
+			// Include the time the round waited for a worker, which a
+			// closed loop hides.
+			res.latency = time.Since(scheduled)
+		}
+		if res.err != nil && ctx.Err() != nil {
+			return nil // another worker failed first or the run was aborted
+		}
+		r.report(w, round, stage, res)
+		if res.err != nil && !r.tolerateErrors {
+			return res.err
+		}
+	}
+	return nil
+}
+
+// opStatsFor returns the stats of an operation, adding them if needed.
+func opStatsFor(stats map[string]*opStats, op string) *opStats {
+	s, ok := stats[op]
+	if !ok {
+		s = &opStats{}
+		stats[op] = s
+	}
+	return s
+}
+
+// report records the result of a round started in the given stage of the
+// profile, if any.
+func (r *runner) report(w *worker, round, stage int, res opResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := opStatsFor(r.stats, res.op)
+	s.count++
+	var st *stageStats
+	var ss *opStats
+	if stage >= 0 {
+		st = r.stages[stage]
+		ss = opStatsFor(st.stats, res.op)
+		ss.count++
+	}
+	quadCount := 0
+	if res.quads != nil {
+		quadCount = res.quads.Size()
+	}
+	if r.results != nil {
+		rec := roundRecord{Worker: w.id, Round: round, Op: res.op, Quads: quadCount, LatencyMs: durationMs(res.latency)}
+		if res.err != nil {
+			rec.Category = string(ErrorCategoryOf(res.err))
+			rec.Error = res.err.Error()
+		}
+		r.results.Round(rec)
+	}
+	if res.err != nil {
+		s.errors++
+		if ss != nil {
+			ss.errors++
+		}
+		fmt.Printf("# worker %d round %d %s %s error: %s\n", w.id, round, res.op, ErrorCategoryOf(res.err), res.err)
+		return
+	}
+
+	if res.quads != nil && r.printQuads {
+		fmt.Printf("%s\n\n\n\n", res.quads.String())
+	}
+	fmt.Printf("%d,%d,%s,%d,%d\n", w.id, round, res.op, quadCount, res.latency.Milliseconds())
+	r.totalRounds++
+	r.totalQuads += int64(quadCount)
+	s.latency.Record(res.latency)
+	if st != nil {
+		st.rounds++
+		st.quads += int64(quadCount)
+		ss.latency.Record(res.latency)
+	}
+}
+
+func (r *runner) missSchedule() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.missed++
+	scheduleMissesTotal.Inc()
+}
+
+func (r *runner) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.firstErr == nil {
+		r.firstErr = err
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Policies applied to the values containing characters that the original
+// RDF filter considered invalid.
+const (
+	sanitizeStrip  = "strip"  // remove the characters, as the RDF filter did
+	sanitizeEscape = "escape" // keep the value, escaping it where it is rendered
+	sanitizeReject = "reject" // refuse the value, failing the mutation
+)
+
+var replacer *strings.Replacer
+
+func init() {
+	replacer = strings.NewReplacer(
+		string(byte(0x08)), " ", // backspace
+		string(byte(0x0C)), " ", // form feed
+		string(byte(0x0A)), " ", // new line
+		string(byte(0x0D)), " ", // carriage return
+		string(byte(0x09)), " ", // tab
+		`\b`, " ",
+		`\f`, " ",
+		`\n`, " ",
+		`\r`, " ",
+		`\t`, " ",
+		`\"`, " ",
+		`^`, "",
+		`{`, "",
+		`}`, "",
+		"`", "",
+		`~`, "",
+		`\`, "",
+		`"`, "",
+	)
+}
+
+func stripInvalidChars(s string) string {
+	return trimValue(replacer.Replace(s))
+}
+
+// hasInvalidChars reports whether s contains characters removed or replaced
+// by stripInvalidChars.
+func hasInvalidChars(s string) bool {
+	return replacer.Replace(s) != s
+}
+
+// trimValue trims the surrounding spaces and the blank node prefix of a value,
+// as the original RDF filter did. Trimming is not an alteration.
+func trimValue(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "_:")
+	s = strings.TrimSpace(s)
+	return s
+}
+
+// Sanitizer applies a sanitize policy to the values added to quads and
+// counts the values it sanitized and those it altered, escaped or rejected.
+// It is safe for concurrent use.
+type Sanitizer struct {
+	policy  string
+	values  int64
+	altered int64
+}
+
+// NewSanitizer returns a sanitizer applying policy.
+func NewSanitizer(policy string) (*Sanitizer, error) {
+	switch policy {
+	case sanitizeStrip, sanitizeEscape, sanitizeReject:
+		return &Sanitizer{policy: policy}, nil
+	}
+	return nil, fmt.Errorf("unknown sanitize policy %q", policy)
+}
+
+// sanitizer is the sanitizer used by the quads.
+var sanitizer = &Sanitizer{policy: sanitizeStrip}
+
+// Value returns the value to store for s, or an error if s is rejected. Only
+// the values containing invalid characters are altered, escaped or rejected;
+// the others are trimmed unless escaped.
+func (z *Sanitizer) Value(s string) (string, error) {
+	atomic.AddInt64(&z.values, 1)
+	if z.policy == sanitizeEscape {
+		if hasInvalidChars(s) {
+			atomic.AddInt64(&z.altered, 1)
+		}
+		return s, nil
+	}
+	if !hasInvalidChars(s) {
+		return trimValue(s), nil
+	}
+	atomic.AddInt64(&z.altered, 1)
+	if z.policy == sanitizeReject {
+		return "", fmt.Errorf("value %q contains invalid characters", s)
+	}
+	return stripInvalidChars(s), nil
+}
+
+// Policy returns the policy applied by the sanitizer.
+func (z *Sanitizer) Policy() string {
+	return z.policy
+}
+
+// Counts returns the number of values sanitized, and of those that were
+// altered, escaped or rejected depending on the policy.
+func (z *Sanitizer) Counts() (values, altered int64) {
+	return atomic.LoadInt64(&z.values), atomic.LoadInt64(&z.altered)
+}
+
+// Summary describes the sanitized values.
+func (z *Sanitizer) Summary() string {
+	verb := map[string]string{sanitizeStrip: "altered", sanitizeEscape: "escaped", sanitizeReject: "rejected"}[z.policy]
+	values, altered := z.Counts()
+	return fmt.Sprintf("Sanitize %s: %d of %d values %s", z.policy, altered, values, verb)
+}
+
+// dqlQuote quotes a string as a DQL string literal.
+func dqlQuote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// withSanitizer runs fn with the quads using a sanitizer applying policy.
+func withSanitizer(t *testing.T, policy string, fn func(z *Sanitizer)) {
+	t.Helper()
+	z, err := NewSanitizer(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := sanitizer
+	sanitizer = z
+	defer func() { sanitizer = prev }()
+	fn(z)
+}
+
+func TestSanitizeStrip(t *testing.T) {
+	withSanitizer(t, sanitizeStrip, func(z *Sanitizer) {
+		q := NewQuads()
+		q.SetQuadStr("_:a", "name", `say "hi" {x}`)
+		q.SetQuadStr("_:a", "other", "plain")
+		q.SetQuadStr("_:a", "empty", `""`)
+		if q.Size() != 2 {
+			t.Fatalf("expected 2 quads, got %d", q.Size())
+		}
+		if got := q.setQuads[0].ObjectValue.GetStrVal(); got != "say hi x" {
+			t.Errorf("expected the value to be stripped, got %q", got)
+		}
+		if values, altered := z.Counts(); values != 3 || altered != 2 {
+			t.Errorf("expected 2 of 3 values altered, got %d of %d", altered, values)
+		}
+	})
+}
+
+func TestSanitizeEscape(t *testing.T) {
+	withSanitizer(t, sanitizeEscape, func(z *Sanitizer) {
+		value := "_:say \"hi\"\n\\ {x}"
+		q := NewQuads()
+		id := q.AddUpsertQuery("name", value, "Node0")
+		q.SetQuadStrUpsert(id, "name", value, CreateFacetString("note", `a "b"`))
+		if q.Err() != nil {
+			t.Fatalf("unexpected error: %s", q.Err())
+		}
+		nq := q.setQuads[0]
+		if got := nq.ObjectValue.GetStrVal(); got != value {
+			t.Errorf("expected the value to be kept, got %q", got)
+		}
+		if got := string(nq.Facets[0].Value); got != `a "b"` {
+			t.Errorf("expected the facet to be kept, got %q", got)
+		}
+		if query := q.Request().Query; !strings.Contains(query, `eq(name, "_:say \"hi\"\n\\ {x}")`) {
+			t.Errorf("expected the value to be escaped in the upsert query, got:\n%s", query)
+		}
+
+		set, err := q.SetRDF()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nqs, err := ParseRDF(strings.NewReader(set))
+		if err != nil {
+			t.Fatalf("unable to parse %s: %s", set, err)
+		}
+		if got := nqs[0].ObjectValue.GetStrVal(); got != value {
+			t.Errorf("expected the value to survive RDF escaping, got %q", got)
+		}
+		if _, altered := z.Counts(); altered != 3 {
+			t.Errorf("expected 3 values escaped, got %d", altered)
+		}
+	})
+}
+
+func TestSanitizeReject(t *testing.T) {
+	withSanitizer(t, sanitizeReject, func(z *Sanitizer) {
+		q := NewQuads()
+		q.SetQuadStr("_:a", "name", "fine")
+		q.SetQuadStr("_:a", "bad", `a "b"`)
+		if q.Size() != 1 {
+			t.Errorf("expected the rejected quad to be skipped, got %d quads", q.Size())
+		}
+		if q.Err() == nil {
+			t.Fatal("expected the rejected value to be reported")
+		}
+		q.Clear()
+		if q.Err() != nil {
+			t.Errorf("expected no error after clearing, got %s", q.Err())
+		}
+	})
+}
+
+func TestSanitizeRejectGenerator(t *testing.T) {
+	cfg := testConfig{nodeTypeCount: 2, nodePredCount: 3, predStringLen: 20, rounds: 4, workers: 1}
+	for _, policy := range []string{sanitizeStrip, sanitizeEscape, sanitizeReject} {
+		withSanitizer(t, policy, func(z *Sanitizer) {
+			gen := newSubgraphsGenerator(cfg)
+			rng := rand.New(rand.NewSource(1))
+			q := NewQuads()
+			for round := 0; round < cfg.rounds; round++ {
+				gen.Round(q, rng, 0, round)
+			}
+			if q.Err() != nil {
+				t.Errorf("%s: unexpected error: %s", policy, q.Err())
+			}
+			if values, altered := z.Counts(); values == 0 || altered != 0 {
+				t.Errorf("%s: expected no generated value altered, got %d of %d", policy, altered, values)
+			}
+		})
+	}
+}
+
+func TestSanitizeRejectFailsMutation(t *testing.T) {
+	fs := startFakeServer(t)
+	gc := fs.connect(t, fs.connOptions())
+	withSanitizer(t, sanitizeReject, func(z *Sanitizer) {
+		q := NewQuads()
+		q.SetQuadStr("_:a", "name", `a "b"`)
+		if err := gc.Mutate(context.Background(), q); err == nil {
+			t.Error("expected the mutation to fail")
+		}
+		if n := len(fs.Requests()); n != 0 {
+			t.Errorf("expected no requests, got %d", n)
+		}
+	})
+}
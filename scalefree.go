@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// defaultEdgesPerNode is the number of edges of each new node of a scale-free
+// graph when none is set.
+const defaultEdgesPerNode = 3
+
+// Grows a scale-free graph by preferential attachment (the Barabási–Albert
+// model): every round adds a node of each type, linked to existing nodes
+// picked with a probability proportional to their degree, so that a few hub
+// nodes end up with most of the edges. Each worker grows its own graph, kept
+// in memory for the whole run: 4+8*edgesPerNode bytes per node, about 700 MB
+// for the default 500000 rounds of 50 node types and 3 edges per node.
+type scaleFreeGenerator struct {
+	cfg          testConfig
+	edgesPerNode int
+
+	mu     sync.Mutex // guards graphs
+	graphs map[int]*attachmentGraph
+}
+
+func newScaleFreeGenerator(cfg testConfig) Generator {
+	m := cfg.edgesPerNode
+	if m <= 0 {
+		m = defaultEdgesPerNode
+	}
+	return &scaleFreeGenerator{cfg: cfg, edgesPerNode: m, graphs: make(map[int]*attachmentGraph)}
+}
+
+func (g *scaleFreeGenerator) Header() string {
+	return fmt.Sprintf("Test Scale-Free: %d rounds; %d node types; %d predicates; %d edges per new node", g.cfg.rounds, g.cfg.nodeTypeCount, g.cfg.nodePredCount, g.edgesPerNode)
+}
+
+func (g *scaleFreeGenerator) Static() bool {
+	return false
+}
+
+func (g *scaleFreeGenerator) NodeName(worker, round, i int) string {
+	return nodeName(worker, round, i)
+}
+
+// graph returns the graph grown by a worker.
+func (g *scaleFreeGenerator) graph(worker int) *attachmentGraph {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ag, ok := g.graphs[worker]
+	if !ok {
+		ag = &attachmentGraph{}
+		g.graphs[worker] = ag
+	}
+	return ag
+}
+
+func (g *scaleFreeGenerator) Round(q *Quads, rng *rand.Rand, worker, round int) {
+	ag := g.graph(worker)
+	types := g.cfg.nodeTypeCount
+	for i := 0; i < types; i++ {
+		name := nodeName(worker, round, i)
+		nodeType := fmt.Sprintf("Node%d", i)
+		upsertIDCurrent := q.AddUpsertQuery("name", name, nodeType)
+
+		q.SetQuadStrUpsert(upsertIDCurrent, "dgraph.type", nodeType)
+		q.SetQuadStrUpsert(upsertIDCurrent, "name", name)
+		for j := 0; j < g.cfg.nodePredCount; j++ {
+			q.SetQuadStrUpsert(upsertIDCurrent, fmt.Sprintf("pred%d", j), randomString(rng, g.cfg.predStringLen))
+		}
+
+		targets := ag.pickTargets(rng, g.edgesPerNode)
+		for _, t := range targets {
+			linkRound, k := int(t)/types, int(t)%types
+			upsertIDLink := q.AddUpsertQuery("name", nodeName(worker, linkRound, k), fmt.Sprintf("Node%d", k))
+			q.SetQuadRelUpsertFromTo(upsertIDCurrent, fmt.Sprintf("LINK%d", k), upsertIDLink)
+		}
+		ag.add(int32(round*types+i), targets)
+	}
+}
+
+// attachmentGraph is a graph grown by preferential attachment. Its nodes are
+// numbered round * node types + type, as in the random graphs, so a worker's
+// graph holds at most 2^31 nodes.
+type attachmentGraph struct {
+	nodes []int32
+	// ends holds both ends of every edge, so that picking one at random
+	// picks a node with a probability proportional to its degree.
+	ends []int32
+}
+
+// pickTargets returns m distinct nodes to link a new node to, picked with a
+// probability proportional to their degree, or all the nodes if there are no
+// more than m.
+func (ag *attachmentGraph) pickTargets(rng *rand.Rand, m int) []int32 {
+	if len(ag.nodes) <= m {
+		return append([]int32(nil), ag.nodes...)
+	}
+	targets := make([]int32, 0, m)
+	picked := make(map[int32]bool, m)
+	for len(targets) < m {
+		n := ag.ends[rng.Intn(len(ag.ends))]
+		if !picked[n] {
+			picked[n] = true
+			targets = append(targets, n)
+		}
+	}
+	return targets
+}
+
+// add adds a node and its edges to the targets.
+func (ag *attachmentGraph) add(n int32, targets []int32) {
+	ag.nodes = append(ag.nodes, n)
+	for _, t := range targets {
+		ag.ends = append(ag.ends, n, t)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestScaleFreeGenerator(t *testing.T) {
+	cfg := testConfig{nodeTypeCount: 2, nodePredCount: 1, predStringLen: 8, edgesPerNode: 2}
+	gen := newScaleFreeGenerator(cfg)
+	rng := rand.New(rand.NewSource(1))
+	const rounds = 500
+	degree := make(map[string]int)
+	edges := 0
+	for round := 0; round < rounds; round++ {
+		q := NewQuads()
+		gen.Round(q, rng, 1, round)
+		names := make(map[string]string)
+		for _, uqr := range q.upsertIDs {
+			names["uid("+string(uqr.id)+")"] = uqr.value
+		}
+		newEdges := make(map[string]int)
+		for _, nq := range q.setQuads {
+			if !strings.HasPrefix(nq.Predicate, "LINK") {
+				continue
+			}
+			from, to := names[nq.Subject], names[nq.ObjectId]
+			if from == to {
+				t.Fatalf("round %d: unexpected self loop on %s", round, from)
+			}
+			degree[from]++
+			degree[to]++
+			newEdges[from]++
+			edges++
+		}
+		if round > 1 {
+			for i := 0; i < cfg.nodeTypeCount; i++ {
+				if n := newEdges[nodeName(1, round, i)]; n != 2 {
+					t.Fatalf("round %d: expected 2 edges from node %d, got %d", round, i, n)
+				}
+			}
+		}
+	}
+
+	if len(degree) != rounds*cfg.nodeTypeCount {
+		t.Errorf("expected %d linked nodes, got %d", rounds*cfg.nodeTypeCount, len(degree))
+	}
+	max := 0
+	for _, d := range degree {
+		if d > max {
+			max = d
+		}
+	}
+	mean := float64(2*edges) / float64(len(degree))
+	if float64(max) < 5*mean {
+		t.Errorf("expected hub nodes with a degree far above the mean %.1f, got a max of %d", mean, max)
+	}
+}
+
+func TestScaleFreeGeneratorWorkers(t *testing.T) {
+	gen := newScaleFreeGenerator(testConfig{nodeTypeCount: 1, edgesPerNode: 1})
+	q := NewQuads()
+	gen.Round(q, rand.New(rand.NewSource(1)), 0, 0)
+	gen.Round(q, rand.New(rand.NewSource(1)), 1, 0)
+	// The first node of each worker's graph has no node to link to yet.
+	for _, nq := range q.setQuads {
+		if strings.HasPrefix(nq.Predicate, "LINK") {
+			t.Errorf("expected workers to grow separate graphs, got edge %v", nq)
+		}
+	}
+}
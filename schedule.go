@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Distributions of the round arrivals of an open-loop run.
+const (
+	arrivalConstant = "constant"
+	arrivalPoisson  = "poisson"
+)
+
+// scheduleSlack is how late a round may start before it counts as having
+// missed its schedule.
+const scheduleSlack = time.Millisecond
+
+// parseRate parses a rate as a count per unit of time, e.g. 200/s, 30/m or
+// 5/100ms, and returns it per second. A count alone is per second.
+func parseRate(spec string) (float64, error) {
+	count, unit := spec, "s"
+	if i := strings.Index(spec, "/"); i >= 0 {
+		count, unit = spec[:i], spec[i+1:]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate %q: the count must be a positive number", spec)
+	}
+	unit = strings.TrimSpace(unit)
+	if unit != "" && (unit[0] < '0' || unit[0] > '9') {
+		unit = "1" + unit
+	}
+	per, err := time.ParseDuration(unit)
+	if err != nil || per <= 0 {
+		return 0, fmt.Errorf("invalid rate %q: must be count/unit, e.g. 200/s", spec)
+	}
+	return n / per.Seconds(), nil
+}
+
+// arrivalSchedule gives the scheduled start times of the rounds of an
+// open-loop run, at a rate of rounds per second, either evenly spaced or as a
+// Poisson process. It is safe for concurrent use.
+type arrivalSchedule struct {
+	rate    float64
+	arrival string
+
+	mu   sync.Mutex // guards rng and next
+	rng  *rand.Rand
+	next time.Time
+}
+
+func newArrivalSchedule(rate float64, arrival string, seed int64) *arrivalSchedule {
+	return &arrivalSchedule{rate: rate, arrival: arrival, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (s *arrivalSchedule) String() string {
+	return fmt.Sprintf("%g rounds/s (%s)", s.rate, s.arrival)
+}
+
+// Start schedules the first round at t.
+func (s *arrivalSchedule) Start(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = t
+}
+
+// SetRate changes the rate of the rounds scheduled after the next one.
+func (s *arrivalSchedule) SetRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rate = rate
+}
+
+// Next returns the scheduled start time of the next round.
+func (s *arrivalSchedule) Next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.next
+	interval := 1 / s.rate
+	if s.arrival == arrivalPoisson {
+		interval = s.rng.ExpFloat64() / s.rate
+	}
+	s.next = t.Add(time.Duration(interval * float64(time.Second)))
+	return t
+}
+
+// waitUntil waits until t, and returns false if stop or ctx are done first.
+func waitUntil(stop, ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop.Done():
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
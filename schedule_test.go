@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		spec string
+		rate float64
+	}{
+		{"200/s", 200},
+		{"200", 200},
+		{"30/m", 0.5},
+		{"5/100ms", 50},
+		{"1.5/s", 1.5},
+	}
+	for _, tt := range tests {
+		rate, err := parseRate(tt.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.spec, err)
+			continue
+		}
+		if math.Abs(rate-tt.rate) > 1e-9 {
+			t.Errorf("%s: expected %g/s, got %g/s", tt.spec, tt.rate, rate)
+		}
+	}
+	for _, spec := range []string{"", "0/s", "-1/s", "fast", "10/x", "10/0s"} {
+		if _, err := parseRate(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestArrivalSchedule(t *testing.T) {
+	start := time.Unix(0, 0)
+	s := newArrivalSchedule(100, arrivalConstant, 1)
+	s.Start(start)
+	for i := 0; i < 3; i++ {
+		if got, want := s.Next(), start.Add(time.Duration(i)*10*time.Millisecond); !got.Equal(want) {
+			t.Errorf("round %d: expected %s, got %s", i, want, got)
+		}
+	}
+
+	s = newArrivalSchedule(100, arrivalPoisson, 1)
+	s.Start(start)
+	const n = 10000
+	var last time.Time
+	for i := 0; i < n; i++ {
+		last = s.Next()
+	}
+	if mean := last.Sub(start) / n; mean < 9*time.Millisecond || mean > 11*time.Millisecond {
+		t.Errorf("expected a mean interval of about 10ms, got %s", mean)
+	}
+}
+
+// sleepWorkload performs rounds taking a fixed time.
+type sleepWorkload time.Duration
+
+func (wl sleepWorkload) Header() string { return "sleep" }
+
+func (wl sleepWorkload) Do(ctx context.Context, w *worker, round int) opResult {
+	time.Sleep(time.Duration(wl))
+	return opResult{op: "sleep", latency: time.Duration(wl)}
+}
+
+func TestRunnerOpenLoop(t *testing.T) {
+	rc := runContexts{stop: context.Background(), ops: context.Background()}
+	cfg := testConfig{rounds: 5, workers: 1}
+
+	r := newRunner(sleepWorkload(0), cfg)
+	r.schedule = newArrivalSchedule(100, arrivalConstant, 1)
+	startTime := time.Now()
+	if err := r.Run(rc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if elapsed := time.Since(startTime); elapsed < 40*time.Millisecond {
+		t.Errorf("expected 5 rounds at 100/s to take at least 40ms, took %s", elapsed)
+	}
+	if r.missed != 0 {
+		t.Errorf("expected no missed rounds, got %d", r.missed)
+	}
+
+	// Rounds taking longer than the interval fall behind the schedule, and
+	// their latency includes the time spent waiting for the worker.
+	r = newRunner(sleepWorkload(20*time.Millisecond), cfg)
+	r.schedule = newArrivalSchedule(200, arrivalConstant, 1)
+	if err := r.Run(rc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if r.missed != 4 {
+		t.Errorf("expected 4 missed rounds, got %d", r.missed)
+	}
+	if max := r.stats["sleep"].latency.Max(); max < 80*time.Millisecond {
+		t.Errorf("expected the latency of the last round to include its wait, got %s", max)
+	}
+}
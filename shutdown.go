@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runContexts holds the contexts that bound a run.
+type runContexts struct {
+	// stop is cancelled when no new rounds should be started: on the first
+	// interrupt or once the run duration has elapsed.
+	stop context.Context
+	// ops is passed to the dgraph operations and is cancelled when in-flight
+	// operations should be abandoned: on a second interrupt or once the
+	// shutdown grace period after stop has expired.
+	ops context.Context
+}
+
+// newRunContexts returns the contexts of a run limited to duration, or
+// unlimited if duration is zero. The returned function releases the signal
+// handler and cancels both contexts.
+func newRunContexts(duration, grace time.Duration) (runContexts, func()) {
+	stopCtx, stopCancel := context.WithCancel(context.Background())
+	opsCtx, opsCancel := context.WithCancel(context.Background())
+
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	var timer *time.Timer
+	var timeUp <-chan time.Time
+	if duration > 0 {
+		timer = time.NewTimer(duration)
+		timeUp = timer.C
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigCh:
+			fmt.Printf("# Received %s, finishing in-flight operations (%s grace period; repeat to abort)\n", sig, grace)
+		case <-timeUp:
+			fmt.Printf("# Run duration of %s elapsed, finishing in-flight operations\n", duration)
+		case <-done:
+			return
+		}
+		stopCancel()
+
+		select {
+		case sig := <-sigCh:
+			fmt.Printf("# Received %s, aborting in-flight operations\n", sig)
+		case <-time.After(grace):
+			fmt.Println("# Shutdown grace period expired, aborting in-flight operations")
+		case <-done:
+			return
+		}
+		opsCancel()
+	}()
+
+	release := func() {
+		signal.Stop(sigCh)
+		if timer != nil {
+			timer.Stop()
+		}
+		close(done)
+		stopCancel()
+		opsCancel()
+	}
+	return runContexts{stop: stopCtx, ops: opsCtx}, release
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// histSubBucketBits sets the precision of the histogram: values are
+	// recorded with a relative error of at most 1/2^(histSubBucketBits-1),
+	// i.e. about three significant digits.
+	histSubBucketBits  = 11
+	histSubBucketCount = 1 << histSubBucketBits
+	histSubBucketHalf  = histSubBucketCount / 2
+)
+
+// Histogram is an HDR-style log-linear histogram of latencies recorded in
+// microseconds. The zero value is ready to use; it is not safe for concurrent
+// use.
+type Histogram struct {
+	counts []int64
+	count  int64
+	min    int64
+	max    int64
+	sum    float64
+	sumSq  float64
+}
+
+func histIndex(v int64) int {
+	if v < histSubBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histSubBucketBits
+	sub := v >> uint(shift)
+	return histSubBucketCount + (shift-1)*histSubBucketHalf + int(sub-histSubBucketHalf)
+}
+
+// histHighestEquivalent returns the largest value recorded in the bucket at
+// index i.
+func histHighestEquivalent(i int) int64 {
+	if i < histSubBucketCount {
+		return int64(i)
+	}
+	k := i - histSubBucketCount
+	shift := uint(k/histSubBucketHalf + 1)
+	sub := int64(k%histSubBucketHalf + histSubBucketHalf)
+	return (sub << shift) + (1 << shift) - 1
+}
+
+// Record adds a latency to the histogram.
+func (h *Histogram) Record(d time.Duration) {
+	v := d.Microseconds()
+	if v < 0 {
+		v = 0
+	}
+	i := histIndex(v)
+	if i >= len(h.counts) {
+		counts := make([]int64, i+1+histSubBucketHalf)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += float64(v)
+	h.sumSq += float64(v) * float64(v)
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// Min returns the smallest recorded value.
+func (h *Histogram) Min() time.Duration {
+	return time.Duration(h.min) * time.Microsecond
+}
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Mean returns the arithmetic mean of the recorded values.
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/float64(h.count)) * time.Microsecond
+}
+
+// StdDev returns the population standard deviation of the recorded values.
+func (h *Histogram) StdDev() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	mean := h.sum / float64(h.count)
+	variance := h.sumSq/float64(h.count) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return time.Duration(math.Sqrt(variance)) * time.Microsecond
+}
+
+// Percentile returns the value below which p percent of the recorded values
+// fall, within the precision of the histogram.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(p / 100 * float64(h.count)))
+	if target < 1 {
+		target = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			v := histHighestEquivalent(i)
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteLatency writes a one line summary of the latency distribution.
+func (h *Histogram) WriteLatency(w io.Writer, label string) {
+	fmt.Fprintf(w, "# %s latency (ms): count=%d min=%.3f mean=%.3f stddev=%.3f p50=%.3f p90=%.3f p99=%.3f p99.9=%.3f max=%.3f\n",
+		label, h.count, durationMs(h.Min()), durationMs(h.Mean()), durationMs(h.StdDev()),
+		durationMs(h.Percentile(50)), durationMs(h.Percentile(90)), durationMs(h.Percentile(99)), durationMs(h.Percentile(99.9)),
+		durationMs(h.Max()))
+}
+
+// writeThroughput writes the rounds and quads per second achieved over elapsed.
+func writeThroughput(w io.Writer, rounds, quads int64, elapsed time.Duration) {
+	var roundsPerSec, quadsPerSec float64
+	if secs := elapsed.Seconds(); secs > 0 {
+		roundsPerSec = float64(rounds) / secs
+		quadsPerSec = float64(quads) / secs
+	}
+	fmt.Fprintf(w, "# Throughput: %.1f rounds/s; %.1f quads/s\n", roundsPerSec, quadsPerSec)
+}
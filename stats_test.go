@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistIndex(t *testing.T) {
+	tests := []struct {
+		v       int64
+		index   int
+		highest int64
+	}{
+		{0, 0, 0},
+		{2047, 2047, 2047},
+		{2048, 2048, 2049},
+		{2049, 2048, 2049},
+		{2050, 2049, 2051},
+		{4095, 3071, 4095},
+		{4096, 3072, 4099},
+	}
+	for _, tt := range tests {
+		i := histIndex(tt.v)
+		if i != tt.index {
+			t.Errorf("%d: expected index %d, got %d", tt.v, tt.index, i)
+		}
+		if h := histHighestEquivalent(i); h != tt.highest {
+			t.Errorf("%d: expected a highest equivalent of %d, got %d", tt.v, tt.highest, h)
+		}
+	}
+
+	// Every value falls in a bucket whose highest value is within the
+	// precision of the histogram.
+	for v := int64(0); v < 1<<20; v += 7 {
+		h := histHighestEquivalent(histIndex(v))
+		if h < v || float64(h-v) > float64(v)/histSubBucketHalf {
+			t.Fatalf("%d: highest equivalent %d out of precision", v, h)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	if h.Count() != 0 || h.Percentile(50) != 0 || h.Mean() != 0 || h.StdDev() != 0 || h.Min() != 0 || h.Max() != 0 {
+		t.Errorf("expected zeros from an empty histogram")
+	}
+
+	for v := 1; v <= 1000; v++ {
+		h.Record(time.Duration(v) * time.Microsecond)
+	}
+	if h.Count() != 1000 || h.Min() != time.Microsecond || h.Max() != time.Millisecond {
+		t.Errorf("expected 1000 values from 1µs to 1ms, got %d from %s to %s", h.Count(), h.Min(), h.Max())
+	}
+	for _, tt := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1 * time.Microsecond},
+		{50, 500 * time.Microsecond},
+		{90, 900 * time.Microsecond},
+		{99, 990 * time.Microsecond},
+		{100, 1000 * time.Microsecond},
+	} {
+		if got := h.Percentile(tt.p); got != tt.want {
+			t.Errorf("p%g: expected %s, got %s", tt.p, tt.want, got)
+		}
+	}
+	// The mean is 500.5µs and the standard deviation sqrt((1000^2-1)/12).
+	if h.Mean() != 500*time.Microsecond {
+		t.Errorf("expected a mean of 500µs, got %s", h.Mean())
+	}
+	if h.StdDev() != 288*time.Microsecond {
+		t.Errorf("expected a standard deviation of 288µs, got %s", h.StdDev())
+	}
+
+	// Large values keep about three significant digits, and are capped at
+	// the max.
+	h = Histogram{}
+	h.Record(10 * time.Second)
+	h.Record(12345678 * time.Microsecond)
+	if p := h.Percentile(50); p < 10*time.Second || p > 10*time.Second+10*time.Millisecond {
+		t.Errorf("expected p50 within 0.1%% of 10s, got %s", p)
+	}
+	if p := h.Percentile(100); p != 12345678*time.Microsecond {
+		t.Errorf("expected p100 at the max, got %s", p)
+	}
+}
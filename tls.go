@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSOptions holds the files and settings used to secure dgraph connections
+// with TLS.
+type TLSOptions struct {
+	CACert     string // PEM file of the CA certificates used to verify the server
+	Cert       string // PEM file of the client certificate, for mutual TLS
+	Key        string // PEM file of the client private key, for mutual TLS
+	ServerName string // name used to verify the server certificate, if not the host
+}
+
+// Enabled returns true if any TLS option is set.
+func (o TLSOptions) Enabled() bool {
+	return o.CACert != "" || o.Cert != "" || o.Key != "" || o.ServerName != ""
+}
+
+// Config builds the client TLS configuration. Without a CA certificate the
+// server is verified with the system CA certificates.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: o.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if o.CACert != "" {
+		pem, err := ioutil.ReadFile(o.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read TLS CA certificate: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in TLS CA certificate file %s", o.CACert)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.Cert != "" || o.Key != "" {
+		if o.Cert == "" || o.Key == "" {
+			return nil, fmt.Errorf("both a TLS client certificate and key must be provided for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(o.Cert, o.Key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load TLS client certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
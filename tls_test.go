@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dgoapi "github.com/dgraph-io/dgo/v200/protos/api"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const tlsTestServerName = "alpha.dgraph.test"
+
+// tlsStandIn is a dgraph alpha stand-in that only accepts schema alters.
+type tlsStandIn struct {
+	dgoapi.UnimplementedDgraphServer
+	alters int32
+}
+
+func (s *tlsStandIn) Alter(ctx context.Context, op *dgoapi.Operation) (*dgoapi.Payload, error) {
+	atomic.AddInt32(&s.alters, 1)
+	return &dgoapi.Payload{}, nil
+}
+
+// testPKI holds a CA and the server and client certificates it signed, with
+// their PEM files written to dir.
+type testPKI struct {
+	dir        string
+	caPool     *x509.CertPool
+	serverCert tls.Certificate
+}
+
+func (p *testPKI) path(name string) string {
+	return filepath.Join(p.dir, name)
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "dgraph-stress-test-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testPKI{dir: dir, caPool: x509.NewCertPool()}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.caPool.AddCert(caCert)
+	p.writePEM(t, "ca.crt", "CERTIFICATE", caDER)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.writePEM(t, name+".crt", "CERTIFICATE", der)
+		p.writePEM(t, name+".key", "EC PRIVATE KEY", keyDER)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	p.serverCert = issue(2, tlsTestServerName, x509.ExtKeyUsageServerAuth)
+	issue(3, "client", x509.ExtKeyUsageClientAuth)
+	return p
+}
+
+func (p *testPKI) writePEM(t *testing.T, name, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(p.path(name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTLSStandIn serves a stand-in alpha over TLS, requiring a client
+// certificate if clientAuth is set, and returns its address.
+func startTLSStandIn(t *testing.T, p *testPKI, srv dgoapi.DgraphServer, clientAuth bool) (string, func()) {
+	cfg := &tls.Config{Certificates: []tls.Certificate{p.serverCert}}
+	if clientAuth {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = p.caPool
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(cfg)))
+	dgoapi.RegisterDgraphServer(s, srv)
+	go s.Serve(ln)
+	return ln.Addr().String(), s.Stop
+}
+
+// connectAndAlter opens a connection with the TLS options and loads a schema.
+func connectAndAlter(addr string, tlsOpts TLSOptions) error {
+	cfg, err := tlsOpts.Config()
+	if err != nil {
+		return err
+	}
+	opts := DefaultConnOptions()
+	opts.TLS = cfg
+	opts.Retry.MaxAttempts = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	gc, err := NewGraphConnection(ctx, []string{addr}, opts, zap.NewNop())
+	if err != nil {
+		return err
+	}
+	defer gc.Close()
+	return gc.LoadSchema(ctx, Schema("name: string ."))
+}
+
+func TestTLSConnection(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.dir)
+	srv := &tlsStandIn{}
+	addr, stop := startTLSStandIn(t, p, srv, false)
+	defer stop()
+
+	err := connectAndAlter(addr, TLSOptions{CACert: p.path("ca.crt"), ServerName: tlsTestServerName})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if atomic.LoadInt32(&srv.alters) != 1 {
+		t.Errorf("expected 1 alter, got %d", srv.alters)
+	}
+}
+
+func TestTLSConnectionRejectsWrongServerName(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.dir)
+	addr, stop := startTLSStandIn(t, p, &tlsStandIn{}, false)
+	defer stop()
+
+	err := connectAndAlter(addr, TLSOptions{CACert: p.path("ca.crt"), ServerName: "other.dgraph.test"})
+	if err == nil {
+		t.Fatal("expected an error verifying the server certificate")
+	}
+}
+
+func TestMutualTLSConnection(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.dir)
+	srv := &tlsStandIn{}
+	addr, stop := startTLSStandIn(t, p, srv, true)
+	defer stop()
+
+	err := connectAndAlter(addr, TLSOptions{
+		CACert:     p.path("ca.crt"),
+		Cert:       p.path("client.crt"),
+		Key:        p.path("client.key"),
+		ServerName: tlsTestServerName,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if atomic.LoadInt32(&srv.alters) != 1 {
+		t.Errorf("expected 1 alter, got %d", srv.alters)
+	}
+}
+
+func TestMutualTLSConnectionRequiresClientCert(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.dir)
+	srv := &tlsStandIn{}
+	addr, stop := startTLSStandIn(t, p, srv, true)
+	defer stop()
+
+	err := connectAndAlter(addr, TLSOptions{CACert: p.path("ca.crt"), ServerName: tlsTestServerName})
+	if err == nil {
+		t.Fatal("expected an error without a client certificate")
+	}
+	if atomic.LoadInt32(&srv.alters) != 0 {
+		t.Errorf("expected no alters, got %d", srv.alters)
+	}
+}
+
+func TestTLSOptionsConfig(t *testing.T) {
+	if (TLSOptions{}).Enabled() {
+		t.Error("expected TLS to be disabled without options")
+	}
+	if _, err := (TLSOptions{Cert: "client.crt"}).Config(); err == nil {
+		t.Error("expected an error with a client certificate but no key")
+	}
+	if _, err := (TLSOptions{CACert: "does-not-exist.crt"}).Config(); err == nil {
+		t.Error("expected an error with a missing CA certificate file")
+	}
+}